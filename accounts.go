@@ -0,0 +1,222 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// TokenFor is like TokenWithOptions but keeps the tokens for several
+// accounts, such as a work and a personal one, in a single file, and
+// obtains the token for the named account. The file holds a JSON object
+// mapping account names to tokens, so it cannot be shared with Token.
+// If account looks like an email address, it is sent to the provider
+// as the login_hint parameter, so that the user is asked to sign in
+// to that account.
+func TokenFor(file, account string, cfg *oauth.Config, opts ...Option) (*http.Client, error) {
+	if strings.Contains(account, "@") {
+		opts = append([]Option{WithAuthCodeOptions(oauth.SetAuthURLParam("login_hint", account))}, opts...)
+	}
+	o := newOptions(opts)
+	file, err := cacheFile(file, o.xdg)
+	if err != nil {
+		return nil, err
+	}
+	_, ts, err := cachedToken(&accountCache{*o.fileCache(file), account}, cfg, o)
+	if err != nil {
+		return nil, err
+	}
+	return oauth.NewClient(o.ctx, ts), nil
+}
+
+// Accounts returns the sorted names of the accounts
+// with tokens cached in file, as written by TokenFor.
+// The file name is interpreted as in Token.
+func Accounts(file string) ([]string, error) {
+	file, err := cacheFile(file, true)
+	if err != nil {
+		return nil, err
+	}
+	m, err := readAccounts(file)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// An AccountInfo describes the token cached for one account.
+type AccountInfo struct {
+	Name        string    // account name passed to TokenFor
+	Email       string    // email address from the ID token, if any
+	Expiry      time.Time // expiry of the access token, or zero if it does not expire
+	Refreshable bool      // whether there is a refresh token to renew the access token
+}
+
+// ListAccounts returns information about the tokens cached in file,
+// as written by TokenFor, sorted by account name.
+// The file name is interpreted as in Token.
+func ListAccounts(file string) ([]AccountInfo, error) {
+	file, err := cacheFile(file, true)
+	if err != nil {
+		return nil, err
+	}
+	m, err := readAccounts(file)
+	if err != nil {
+		return nil, err
+	}
+	var list []AccountInfo
+	for name, c := range m {
+		info := AccountInfo{Name: name}
+		if c != nil {
+			info.Email = idTokenEmail(&c.Token)
+			info.Expiry = c.Expiry
+			info.Refreshable = c.RefreshToken != ""
+		}
+		list = append(list, info)
+	}
+	slices.SortFunc(list, func(x, y AccountInfo) int { return strings.Compare(x.Name, y.Name) })
+	return list, nil
+}
+
+// PruneExpired removes from file, as written by TokenFor, the tokens
+// that have expired and cannot be refreshed, which are of no further use,
+// and returns the sorted names of their accounts.
+// The file name is interpreted as in Token.
+func PruneExpired(file string) (removed []string, err error) {
+	file, err = cacheFile(file, true)
+	if err != nil {
+		return nil, err
+	}
+	c := &accountCache{fileCache: fileCache{file: file, perm: filePerm(file)}}
+	unlock, err := c.lock(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	m, err := readAccounts(file)
+	if err != nil {
+		return nil, err
+	}
+	for name, e := range m {
+		if e == nil || e.expired() {
+			removed = append(removed, name)
+			delete(m, name)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	slices.Sort(removed)
+	if err := c.write(m); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// LogoutAccount removes the cached token for account from file,
+// as written by TokenFor, so that the next call to TokenFor for that
+// account prompts the user again. The file name is interpreted as in Token.
+// It is not an error if there is no token for the account.
+func LogoutAccount(file, account string) error {
+	file, err := cacheFile(file, true)
+	if err != nil {
+		return err
+	}
+	c := &accountCache{fileCache{file: file, perm: filePerm(file)}, account}
+	unlock, err := c.lock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	m, err := readAccounts(file)
+	if err != nil {
+		return err
+	}
+	if _, ok := m[account]; !ok {
+		return nil
+	}
+	delete(m, account)
+	return c.write(m)
+}
+
+// An accountCache is a cache holding the token for one account
+// in a file shared with other accounts.
+type accountCache struct {
+	fileCache
+	account string
+}
+
+func (c *accountCache) load() (*cacheEntry, error) {
+	m, err := readAccounts(c.file)
+	if err != nil {
+		return nil, err
+	}
+	return m[c.account], nil
+}
+
+func (c *accountCache) save(e *cacheEntry) error {
+	m, err := readAccounts(c.file)
+	if err != nil {
+		return err
+	}
+	m[c.account] = e.withExtra()
+	return c.write(m)
+}
+
+// filePerm returns the permissions of file, or 0 if it does not exist,
+// so that rewriting the file without the options it was written with
+// keeps permissions set using WithTokenFilePerm.
+func filePerm(file string) os.FileMode {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+	return fi.Mode().Perm()
+}
+
+// readAccounts returns the tokens in the accounts file,
+// or an empty map if the file does not exist.
+func readAccounts(file string) (map[string]*cacheEntry, error) {
+	m := make(map[string]*cacheEntry)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("oauthprompt.Token: %v", err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("oauthprompt.Token: %w %s: %v", ErrCacheCorrupt, file, err)
+	}
+	for _, c := range m {
+		if c != nil {
+			c.restoreExtra()
+		}
+	}
+	return m, nil
+}
+
+// write replaces the tokens in the accounts file with m.
+func (c *accountCache) write(m map[string]*cacheEntry) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return c.fileCache.write(data)
+}
@@ -0,0 +1,490 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// cacheFile returns the path of the token cache file.
+// A relative file name is resolved against $XDG_CACHE_HOME, if xdg is set
+// and that variable names an absolute directory, and otherwise against
+// the user's home directory. A file already present in the home directory
+// takes precedence over $XDG_CACHE_HOME, so that existing caches keep working.
+// If neither directory is usable, cacheFile returns an error
+// rather than resolving the name against the current directory.
+func cacheFile(file string, xdg bool) (string, error) {
+	if filepath.IsAbs(file) {
+		return file, nil
+	}
+	// A relative home directory would scatter cache files
+	// across whatever directories the program runs in.
+	home, err := os.UserHomeDir()
+	if err == nil && !filepath.IsAbs(home) {
+		err = fmt.Errorf("home directory %q is not an absolute path", home)
+	}
+	if xdg {
+		if dir := os.Getenv("XDG_CACHE_HOME"); filepath.IsAbs(dir) {
+			if err == nil {
+				if _, err := os.Stat(filepath.Join(home, file)); err == nil {
+					return filepath.Join(home, file), nil
+				}
+			}
+			return filepath.Join(dir, file), nil
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("oauthprompt: resolving %s: %v", file, err)
+	}
+	return filepath.Join(home, file), nil
+}
+
+// CachedToken returns the token cached in file, without prompting the user
+// or refreshing the token, so that callers can report its expiry or whether it
+// has a refresh token. The file name is interpreted as in Token.
+// If there is no cached token, the error satisfies errors.Is(err, fs.ErrNotExist).
+func CachedToken(file string) (*oauth.Token, error) {
+	file, err := cacheFile(file, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("oauthprompt.CachedToken: %w", err)
+	}
+	var c cacheEntry
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("oauthprompt.CachedToken: %w %s: %v", ErrCacheCorrupt, file, err)
+	}
+	c.restoreExtra()
+	return &c.Token, nil
+}
+
+// Logout removes the cached token in file, so that the next call to Token
+// prompts the user again. The file name is interpreted as in Token.
+// It is not an error if the file does not exist.
+// See LogoutWithRevoke to also revoke the token.
+func Logout(file string) error {
+	file, err := cacheFile(file, true)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// A cacheEntry is the form of a token stored in a cache file.
+// It is the JSON encoding of the oauth.Token with additional fields,
+// so that files written by older versions of this package,
+// which contain only the token, can still be read.
+type cacheEntry struct {
+	oauth.Token
+
+	// Scopes lists the scopes requested when the token was obtained.
+	// It is nil in files written by older versions of this package.
+	Scopes []string `json:"scopes"`
+
+	// Fingerprint identifies the client and provider
+	// the token was obtained from. See fingerprint.
+	// It is empty in files written by older versions of this package.
+	Fingerprint string `json:"fingerprint"`
+
+	// IDToken is the OpenID Connect ID token returned with the token,
+	// which the JSON encoding of oauth.Token omits along with other
+	// extra fields. Loading the entry restores it as tok.Extra("id_token").
+	IDToken string `json:"id_token,omitempty"`
+
+	// IssuedAt is when the user authorized access. Refreshing the
+	// token does not change it. It is zero in files written by
+	// older versions of this package.
+	IssuedAt time.Time `json:"issued_at"`
+
+	// UserInfo is the response from the WithUserInfoURL endpoint
+	// when the user authorized access, if any.
+	UserInfo map[string]any `json:"userinfo,omitempty"`
+
+	// unverified is set for entries loaded from a Store,
+	// which records neither the scopes nor the fingerprint.
+	unverified bool
+}
+
+// withExtra returns a copy of c with fields recording
+// the token's extra fields set.
+func (c *cacheEntry) withExtra() *cacheEntry {
+	c1 := *c
+	// A refreshed token usually comes without an ID token;
+	// keep the one obtained with the original token.
+	if id, _ := c.Extra("id_token").(string); id != "" {
+		c1.IDToken = id
+	}
+	return &c1
+}
+
+// setToken replaces the entry's token with tok, obtained by refreshing it.
+// A refreshed token usually comes without an ID token,
+// so the one obtained with the original token is kept.
+func (c *cacheEntry) setToken(tok *oauth.Token) {
+	id := c.withExtra().IDToken
+	c.Token = *tok
+	c.IDToken = id
+	if _, ok := tok.Extra("id_token").(string); !ok {
+		c.restoreExtra()
+	}
+}
+
+// restoreExtra restores the token's extra fields
+// from the fields recording them.
+func (c *cacheEntry) restoreExtra() {
+	if c.IDToken != "" {
+		c.Token = *c.Token.WithExtra(map[string]any{"id_token": c.IDToken})
+	}
+}
+
+// fingerprint returns a fingerprint of the client and provider in cfg,
+// so that a token cached for a different client, which the provider will
+// refuse to refresh, is not used. The scopes are not included,
+// because covers checks them in a way that allows a token obtained for
+// more scopes than needed.
+func fingerprint(cfg *oauth.Config) string {
+	h := sha256.Sum256([]byte(cfg.ClientID + "\x00" + cfg.Endpoint.AuthURL))
+	return hex.EncodeToString(h[:16])
+}
+
+// matches reports whether the cached token was obtained using
+// the client and provider in cfg. Tokens from older cache files,
+// which do not record the fingerprint, are conservatively assumed not to match.
+func (c *cacheEntry) matches(cfg *oauth.Config) bool {
+	return c.unverified || c.Fingerprint == fingerprint(cfg)
+}
+
+// covers reports whether the cached token was obtained for
+// all of the given scopes. Tokens that do not record the scopes
+// are assumed to cover any set of scopes.
+func (c *cacheEntry) covers(scopes []string) bool {
+	if c.unverified || c.Scopes == nil {
+		return true
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// A cache holds a cached token.
+type cache interface {
+	// lock locks the cache against concurrent use
+	// and returns a function that unlocks it.
+	// It gives up waiting for the lock when ctx is done.
+	lock(ctx context.Context) (unlock func(), err error)
+
+	// load returns the cached token,
+	// or nil, nil if there is no cached token.
+	load() (*cacheEntry, error)
+
+	// save replaces the cached token with c.
+	save(c *cacheEntry) error
+}
+
+// A noCache is a cache that never holds a token.
+type noCache struct{}
+
+func (noCache) lock(context.Context) (unlock func(), err error) { return func() {}, nil }
+func (noCache) load() (*cacheEntry, error)                      { return nil, nil }
+func (noCache) save(c *cacheEntry) error                        { return nil }
+
+// A readOnlyCache is a cache that loads tokens from another cache
+// but never writes to it, for WithReadOnly.
+type readOnlyCache struct {
+	cache
+	logf func(format string, args ...any)
+}
+
+// lock does nothing: locking a file cache creates files,
+// and a cache that is never written needs no lock.
+func (readOnlyCache) lock(context.Context) (unlock func(), err error) { return func() {}, nil }
+
+func (c readOnlyCache) save(*cacheEntry) error {
+	c.logf("oauthprompt: read-only cache; new token not saved")
+	return nil
+}
+
+// A memCache is a cache kept in memory for the life of the process.
+type memCache struct {
+	held  chan struct{} // holds a value while locked
+	mu    sync.Mutex    // protects entry
+	entry *cacheEntry
+}
+
+var (
+	memCachesMu sync.Mutex
+	memCaches   = make(map[string]*memCache)
+)
+
+// memoryCache returns the in-memory cache for the client and provider in cfg.
+func memoryCache(cfg *oauth.Config) *memCache {
+	memCachesMu.Lock()
+	defer memCachesMu.Unlock()
+	key := fingerprint(cfg)
+	c := memCaches[key]
+	if c == nil {
+		c = &memCache{held: make(chan struct{}, 1)}
+		memCaches[key] = c
+	}
+	return c
+}
+
+func (c *memCache) lock(ctx context.Context) (unlock func(), err error) {
+	select {
+	case c.held <- struct{}{}:
+		return func() { <-c.held }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("oauthprompt.Token: waiting for lock: %w", context.Cause(ctx))
+	}
+}
+
+func (c *memCache) load() (*cacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entry == nil {
+		return nil, nil
+	}
+	e := *c.entry
+	return &e, nil
+}
+
+func (c *memCache) save(e *cacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e1 := *e
+	c.entry = &e1
+	return nil
+}
+
+// A fileCache is a cache stored in a file.
+type fileCache struct {
+	file    string
+	codec   *codec      // encoding of the file; nil means JSON with scopes and fingerprint
+	perm    os.FileMode // permissions of the file; 0 means 0600
+	dirPerm os.FileMode // permissions of created directories; 0 means 0700
+}
+
+// A codec converts tokens to and from the bytes stored in a cache file.
+type codec struct {
+	marshal   func(*oauth.Token) ([]byte, error)
+	unmarshal func([]byte) (*oauth.Token, error)
+}
+
+func (f *fileCache) lock(ctx context.Context) (unlock func(), err error) {
+	// Create the directory now, so that a problem is reported
+	// before the user is asked to authorize access, not after.
+	if err := os.MkdirAll(filepath.Dir(f.file), orDefault(f.dirPerm, 0700)); err != nil {
+		return nil, fmt.Errorf("oauthprompt.Token: %v", err)
+	}
+	unlock, err = lockFile(ctx, f.file+".lock", orDefault(f.perm, 0600))
+	if err != nil {
+		return nil, fmt.Errorf("oauthprompt.Token: locking %s: %w", f.file, err)
+	}
+	return unlock, nil
+}
+
+func (f *fileCache) load() (*cacheEntry, error) {
+	data, err := os.ReadFile(f.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		// Asking the user to authorize access again would not help,
+		// since the new token probably could not be written either.
+		return nil, fmt.Errorf("oauthprompt.Token: reading cache: %v", err)
+	}
+	if f.codec != nil {
+		tok, err := f.codec.unmarshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("oauthprompt.Token: %w %s: %v", ErrCacheCorrupt, f.file, err)
+		}
+		// Like a Store, a codec records only the token.
+		return &cacheEntry{Token: *tok, unverified: true}, nil
+	}
+	var c cacheEntry
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("oauthprompt.Token: %w %s: %v", ErrCacheCorrupt, f.file, err)
+	}
+	c.restoreExtra()
+	return &c, nil
+}
+
+func (f *fileCache) save(c *cacheEntry) error {
+	var data []byte
+	var err error
+	if f.codec != nil {
+		data, err = f.codec.marshal(&c.Token)
+	} else {
+		data, err = json.Marshal(c.withExtra())
+	}
+	if err != nil {
+		return err
+	}
+	return f.write(data)
+}
+
+// write replaces the contents of the file with data.
+func (f *fileCache) write(data []byte) error {
+	return writeFile(f.file, data, orDefault(f.perm, 0600), orDefault(f.dirPerm, 0700))
+}
+
+// orDefault returns perm, or def if perm is zero.
+func orDefault(perm, def os.FileMode) os.FileMode {
+	if perm == 0 {
+		return def
+	}
+	return perm
+}
+
+// writeFile writes data to file atomically, by writing to a temporary file
+// in the same directory and renaming it into place, so that an interrupted
+// write never leaves a truncated cache behind. The file is given
+// permissions perm, and missing parent directories are created
+// with permissions dirPerm.
+func writeFile(file string, data []byte, perm, dirPerm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), dirPerm); err != nil {
+		return err
+	}
+	// CreateTemp creates the file readable only by its owner,
+	// so the token is never exposed with broader permissions.
+	f, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if perm != 0600 {
+		if err := f.Chmod(perm); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), file); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// timeNow is the clock used to judge the expiry and age of cached tokens.
+// Tests may replace it to check them without waiting.
+var timeNow = time.Now
+
+// expiryDelta is how long before its expiry time a token is considered
+// expired, as by oauth2.Token.Valid, to allow for clock skew and the time
+// taken by requests.
+const expiryDelta = 10 * time.Second
+
+// expired reports whether the entry's access token has expired,
+// or is empty, and there is no refresh token to renew it.
+func (c *cacheEntry) expired() bool {
+	valid := c.AccessToken != "" && (c.Expiry.IsZero() || timeNow().Before(c.Expiry.Add(-expiryDelta)))
+	return !valid && c.RefreshToken == ""
+}
+
+// expiresWithin reports whether the entry's access token expires
+// within d. Tokens without an expiry time never do.
+func (c *cacheEntry) expiresWithin(d time.Duration) bool {
+	return d > 0 && !c.Expiry.IsZero() && c.Expiry.Sub(timeNow()) < d
+}
+
+// olderThan reports whether the user authorized access more than d ago.
+// Entries loaded from a Store or written using a codec do not record
+// when that was, so they are never considered too old.
+func (c *cacheEntry) olderThan(d time.Duration) bool {
+	return d > 0 && !c.unverified && timeNow().Sub(c.IssuedAt) > d
+}
+
+// A cachingTokenSource is a TokenSource that writes
+// each new token it obtains to the cache.
+type cachingTokenSource struct {
+	cache  cache
+	entry  cacheEntry // entry to save, with Token replaced
+	src    oauth.TokenSource
+	logf   func(format string, args ...any)
+	notify func(*oauth.Token)
+
+	mu   sync.Mutex
+	last string // access token last written to the cache
+}
+
+func newCachingTokenSource(ctx context.Context, cache cache, cfg *oauth.Config, c *cacheEntry, opts *options) oauth.TokenSource {
+	return &cachingTokenSource{
+		cache:  cache,
+		entry:  *c,
+		src:    cfg.TokenSource(ctx, &c.Token),
+		logf:   opts.logf,
+		notify: opts.notify,
+		last:   c.AccessToken,
+	}
+}
+
+// saveLockWait is how long a cachingTokenSource waits for the cache lock
+// to save a refreshed token. The token is used even if it is not saved.
+var saveLockWait = 10 * time.Second
+
+// save saves e in the cache, holding the lock like cachedToken,
+// so that a refresh for one account in a file shared with others,
+// which rewrites the whole file, does not lose a concurrent update.
+func (s *cachingTokenSource) save(e *cacheEntry) error {
+	// Do not hold up the caller's request for long
+	// if another process is prompting the user.
+	ctx, cancel := context.WithTimeout(context.Background(), saveLockWait)
+	defer cancel()
+	unlock, err := s.cache.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.cache.save(e)
+}
+
+func (s *cachingTokenSource) Token() (*oauth.Token, error) {
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok.AccessToken != s.last {
+		s.last = tok.AccessToken
+		// The new token is usable even if it cannot be saved,
+		// so report the problem but do not fail.
+		e := s.entry
+		e.setToken(tok)
+		if err := s.save(&e); err != nil {
+			s.logf("oauthprompt: saving refreshed token: %v", err)
+		}
+		s.notify(tok)
+	}
+	return tok, nil
+}
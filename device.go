@@ -0,0 +1,166 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// DeviceToken is like Token but uses the OAuth 2.0 device authorization flow
+// (RFC 8628): it prints a URL and a short code for the user to enter there,
+// possibly on another device, and polls the provider until the user
+// has authorized access. It needs no browser or local HTTP server,
+// which suits headless servers and containers.
+// The provider must support the flow, and cfg.Endpoint.DeviceAuthURL must be set.
+// If the user does not authorize access before the code expires,
+// DeviceToken returns an error wrapping ErrDeviceExpired.
+// The options are as for TokenWithOptions.
+func DeviceToken(file string, cfg *oauth.Config, opts ...Option) (*http.Client, error) {
+	return TokenWithOptions(file, cfg, append(opts[:len(opts):len(opts)], WithDeviceFlow(true))...)
+}
+
+// deviceToken obtains a token using the device authorization flow.
+func deviceToken(ctx context.Context, cfg *oauth.Config, opts *options) (*oauth.Token, error) {
+	if cfg.Endpoint.DeviceAuthURL == "" {
+		return nil, fmt.Errorf("oauthprompt.DeviceToken: no DeviceAuthURL in config")
+	}
+	authOpts, exchangeOpts, err := opts.codeOptions()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cfg.DeviceAuth(ctx, authOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if resp.VerificationURIComplete != "" {
+		err = tellUser("To log in, please visit %s\nand confirm the code %s\n", resp.VerificationURIComplete, resp.UserCode)
+	} else {
+		err = tellUser("To log in, please visit %s\nand enter the code %s\n", resp.VerificationURI, resp.UserCode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, opts.timeout, ErrTimeout)
+		defer cancel()
+	}
+	tok, err := opts.pollDevice(ctx, cfg, resp, exchangeOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.checkDomain(tok); err != nil {
+		return nil, err
+	}
+	opts.success(tok)
+	return tok, nil
+}
+
+// deviceGrant is the grant type for device access token requests.
+const deviceGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+// deviceInterval is the unit of the polling interval, which RFC 8628
+// gives in seconds. Tests may shorten it to poll without waiting.
+var deviceInterval = time.Second
+
+// pollDevice polls the token endpoint until the user has authorized
+// the device code in resp, as described in RFC 8628 section 3.5.
+// It waits the interval requested by the provider, plus up to 10%
+// so that many clients started together do not poll in lockstep,
+// and lengthens the interval by 5 seconds whenever the provider
+// says to slow down. It gives up with ErrDeviceExpired once the
+// device code has expired.
+func (o *options) pollDevice(ctx context.Context, cfg *oauth.Config, resp *oauth.DeviceAuthResponse, opts ...oauth.AuthCodeOption) (*oauth.Token, error) {
+	interval := time.Duration(resp.Interval) * deviceInterval
+	if interval <= 0 {
+		interval = 5 * deviceInterval // default required by RFC 8628
+	}
+	// The request is an ordinary token request with a different grant type,
+	// so Exchange can send it, handling client authentication and the
+	// response formats. It adds an empty code parameter, which the token
+	// endpoint must ignore for this grant type.
+	cfg1 := *cfg
+	cfg1.RedirectURL = ""
+	if cfg1.Endpoint.AuthStyle == oauth.AuthStyleAutoDetect {
+		// Auto-detection retries every failed request with the other style,
+		// and each authorization_pending response counts as a failure,
+		// doubling the polling rate. Public clients have no secret to send,
+		// and RFC 6749 requires servers to accept it in the header.
+		cfg1.Endpoint.AuthStyle = oauth.AuthStyleInHeader
+		if cfg1.ClientSecret == "" {
+			cfg1.Endpoint.AuthStyle = oauth.AuthStyleInParams
+		}
+	}
+	opts = append([]oauth.AuthCodeOption{
+		oauth.SetAuthURLParam("grant_type", deviceGrant),
+		oauth.SetAuthURLParam("device_code", resp.DeviceCode),
+		oauth.SetAuthURLParam("client_id", cfg.ClientID),
+	}, opts...)
+	for {
+		wait := interval + rand.N(interval/10+1)
+		if !resp.Expiry.IsZero() && time.Now().Add(wait).After(resp.Expiry) {
+			return nil, fmt.Errorf("oauthprompt.DeviceToken: %w", ErrDeviceExpired)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, pollErr(ctx)
+		}
+		tok, err := cfg1.Exchange(ctx, "", opts...)
+		if err == nil {
+			return tok, nil
+		}
+		var re *oauth.RetrieveError
+		if !errors.As(err, &re) || re.Response == nil {
+			if ctx.Err() != nil {
+				return nil, pollErr(ctx)
+			}
+			// A network error; the next poll may succeed.
+			o.debugf("oauthprompt: polling for device token: %v", err)
+			continue
+		}
+		switch re.ErrorCode {
+		case "authorization_pending":
+			o.debugf("oauthprompt: waiting for user to authorize device")
+		case "slow_down":
+			interval += 5 * deviceInterval
+			o.debugf("oauthprompt: slowing device polling to every %v", interval)
+		case "expired_token":
+			return nil, fmt.Errorf("oauthprompt.DeviceToken: %w", ErrDeviceExpired)
+		case "access_denied":
+			return nil, fmt.Errorf("oauthprompt.DeviceToken: %w: %w", ErrUserDenied, err)
+		default:
+			code := re.Response.StatusCode
+			if code == http.StatusTooManyRequests {
+				interval += 5 * deviceInterval
+				o.debugf("oauthprompt: slowing device polling to every %v", interval)
+				continue
+			}
+			if code >= 500 {
+				o.debugf("oauthprompt: polling for device token: %s", re.Response.Status)
+				continue
+			}
+			return nil, fmt.Errorf("oauthprompt.DeviceToken: %w: %w", ErrExchangeFailed, err)
+		}
+	}
+}
+
+// pollErr returns the error for polling given up because ctx is done:
+// ErrTimeout if WithTimeout expired, and otherwise ctx.Err().
+func pollErr(ctx context.Context) error {
+	if err := context.Cause(ctx); errors.Is(err, ErrTimeout) {
+		return fmt.Errorf("oauthprompt.DeviceToken: %w", err)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,149 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// testDeviceProvider starts a provider supporting the device flow
+// and returns a config using it. The token endpoint answers the
+// successive polls with the errors in replies, and then with a token,
+// recording the time of each poll in *polls.
+func testDeviceProvider(t *testing.T, polls *[]time.Time, replies ...string) *oauth.Config {
+	old := deviceInterval
+	t.Cleanup(func() { deviceInterval = old })
+	deviceInterval = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"device_code":"dev1","user_code":"ABCD-EFGH","verification_uri":"https://provider.example/device","expires_in":600,"interval":1}`)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		*polls = append(*polls, time.Now())
+		if g, d := req.FormValue("grant_type"), req.FormValue("device_code"); g != deviceGrant || d != "dev1" {
+			t.Errorf("token request grant_type=%q device_code=%q, want %q, dev1", g, d, deviceGrant)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if len(replies) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":%q}`, replies[0])
+			replies = replies[1:]
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"token1","token_type":"Bearer","expires_in":3600}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return &oauth.Config{
+		ClientID: "client",
+		Endpoint: oauth.Endpoint{
+			DeviceAuthURL: srv.URL + "/device",
+			TokenURL:      srv.URL + "/token",
+		},
+	}
+}
+
+func TestPollDevice(t *testing.T) {
+	var polls []time.Time
+	cfg := testDeviceProvider(t, &polls, "authorization_pending", "slow_down", "authorization_pending")
+	var logs []string
+	opts := newOptions([]Option{WithVerbose(true), WithLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})})
+	ctx := context.Background()
+	resp, err := cfg.DeviceAuth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := opts.pollDevice(ctx, cfg, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "token1" {
+		t.Errorf("token = %q, want token1", tok.AccessToken)
+	}
+	if len(polls) != 4 {
+		t.Fatalf("%d polls, want 4", len(polls))
+	}
+	// The interval is 1 unit, plus jitter, until slow_down adds 5.
+	if d := polls[1].Sub(polls[0]); d >= 5*deviceInterval {
+		t.Errorf("poll after authorization_pending waited %v, want about %v", d, deviceInterval)
+	}
+	if d := polls[2].Sub(polls[1]); d < 6*deviceInterval {
+		t.Errorf("poll after slow_down waited %v, want at least %v", d, 6*deviceInterval)
+	}
+	if d := polls[3].Sub(polls[2]); d < 6*deviceInterval {
+		t.Errorf("later poll waited %v, want at least %v", d, 6*deviceInterval)
+	}
+	if log := strings.Join(logs, "\n"); !strings.Contains(log, "slowing device polling") {
+		t.Errorf("verbose log does not report slowing down:\n%s", log)
+	}
+}
+
+func TestPollDeviceExpired(t *testing.T) {
+	var polls []time.Time
+	cfg := testDeviceProvider(t, &polls, "authorization_pending", "expired_token")
+	ctx := context.Background()
+	resp, err := cfg.DeviceAuth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newOptions(nil).pollDevice(ctx, cfg, resp)
+	if !errors.Is(err, ErrDeviceExpired) {
+		t.Fatalf("pollDevice after expired_token: err = %v, want ErrDeviceExpired", err)
+	}
+	if len(polls) != 2 {
+		t.Errorf("%d polls, want 2", len(polls))
+	}
+
+	// A code past its expiry time is not polled at all.
+	polls = nil
+	resp.Expiry = time.Now()
+	_, err = newOptions(nil).pollDevice(ctx, cfg, resp)
+	if !errors.Is(err, ErrDeviceExpired) {
+		t.Fatalf("pollDevice after expiry: err = %v, want ErrDeviceExpired", err)
+	}
+	if len(polls) != 0 {
+		t.Errorf("%d polls after expiry, want 0", len(polls))
+	}
+}
+
+func TestDeviceTokenOptions(t *testing.T) {
+	var polls []time.Time
+	pending := make([]string, 1000)
+	for i := range pending {
+		pending[i] = "authorization_pending"
+	}
+	cfg := testDeviceProvider(t, &polls, pending...)
+	file := filepath.Join(t.TempDir(), "token")
+
+	_, err := DeviceToken(file, cfg, WithTimeout(100*time.Millisecond), WithLogger(t.Logf))
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("DeviceToken with timeout: err = %v, want ErrTimeout", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err = TokenWithOptions(file, cfg, WithDeviceFlow(true), WithContext(ctx), WithLogger(t.Logf))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("TokenWithOptions with WithDeviceFlow and canceled context: err = %v, want context.Canceled", err)
+	}
+}
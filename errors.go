@@ -0,0 +1,87 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import "errors"
+
+// Errors returned, possibly wrapped, while waiting for the
+// browser to be redirected back after authorization.
+// Callers can test for them using errors.Is.
+var (
+	// ErrStateMismatch reports a callback whose state parameter does not
+	// match the one sent to the provider, such as one left over from an
+	// earlier attempt or forged by another web page.
+	ErrStateMismatch = errors.New("incorrect response")
+
+	// ErrNoCode reports a callback carrying neither an authorization code
+	// nor an error.
+	ErrNoCode = errors.New("no authorization code in response")
+
+	// ErrTimeout reports that the user did not complete the authorization
+	// within the time set by WithTimeout or TokenTimeout.
+	ErrTimeout = errors.New("timed out waiting for OAuth callback")
+
+	// ErrUserDenied reports that the user declined to authorize access,
+	// which the provider reports as an access_denied error.
+	// DeviceToken returns it too.
+	ErrUserDenied = errors.New("user denied access")
+)
+
+// Other errors returned, wrapped, while obtaining a token.
+// Callers can test for them using errors.Is.
+var (
+	// ErrNoBrowser reports that no browser could be opened
+	// and there is no terminal on which to ask the user
+	// to visit the authorization URL.
+	ErrNoBrowser = errors.New("no browser")
+
+	// ErrExchangeFailed reports that the provider did not exchange
+	// the authorization code for a token. The error wrapping it also
+	// wraps the underlying error, often an *oauth2.RetrieveError.
+	ErrExchangeFailed = errors.New("exchanging authorization code")
+
+	// ErrCacheCorrupt reports a cache file that cannot be decoded.
+	// Logout removes the file, so that the user is asked again.
+	ErrCacheCorrupt = errors.New("corrupt cache file")
+)
+
+// ErrDeviceExpired is returned, wrapped, by DeviceToken when the device
+// code expires before the user has authorized access.
+var ErrDeviceExpired = errors.New("device code expired")
+
+// Errors returned, possibly wrapped, by Validate.
+var (
+	// ErrNoCache reports that there is no cached token.
+	ErrNoCache = errors.New("no cached token")
+
+	// ErrMismatch reports that the cached token was obtained
+	// for a different client or provider, or for fewer scopes,
+	// so that Token would ask the user again.
+	ErrMismatch = errors.New("cached token does not match configuration")
+
+	// ErrExpired reports that the cached token has expired
+	// and cannot be refreshed.
+	ErrExpired = errors.New("cached token expired")
+
+	// ErrUnauthorized reports that the provider rejected the cached token.
+	ErrUnauthorized = errors.New("cached token not authorized")
+)
+
+// A ListenError reports a failure to start the local HTTP server that
+// receives the callback, such as because a fixed port is already in use.
+// The underlying error, which callers can inspect using errors.As or
+// errors.Is, often contains a syscall.Errno such as syscall.EADDRINUSE.
+type ListenError struct {
+	Addr string // address tried, or a comma-separated list of them
+	Err  error  // error from net.Listen
+}
+
+func (e *ListenError) Error() string {
+	return "oauthprompt.Token: starting HTTP server on " + e.Addr + ": " + e.Err.Error()
+}
+
+func (e *ListenError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,102 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// exchange exchanges code for a token using cfg,
+// retrying transient failures as allowed by WithExchangeRetries
+// and logging the outcome for WithVerbose.
+func (o *options) exchange(ctx context.Context, cfg *oauth.Config, code string, opts ...oauth.AuthCodeOption) (*oauth.Token, error) {
+	o.debugf("oauthprompt: exchanging code (%d bytes) at %s with redirect URL %s", len(code), cfg.Endpoint.TokenURL, cfg.RedirectURL)
+	delay := time.Second
+	for try := 0; ; try++ {
+		tok, err := cfg.Exchange(ctx, code, opts...)
+		if err == nil {
+			o.debugf("oauthprompt: obtained %s token expiring %v (refresh token: %v)", tok.Type(), tok.Expiry, tok.RefreshToken != "")
+			if err := o.checkDomain(tok); err != nil {
+				return nil, err
+			}
+			o.success(tok)
+			return tok, nil
+		}
+		var re *oauth.RetrieveError
+		if errors.As(err, &re) && re.Response != nil {
+			o.debugf("oauthprompt: token endpoint returned %s: %s", re.Response.Status, redact(string(re.Body)))
+		} else {
+			o.debugf("oauthprompt: exchange failed: %v", err)
+		}
+		if try >= o.exchangeRetries || !retryable(ctx, err) {
+			return nil, fmt.Errorf("oauthprompt.Token: %w: %w", ErrExchangeFailed, err)
+		}
+		o.logf("oauthprompt: exchange failed, retrying in %v: %v", delay, err)
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("oauthprompt.Token: %w: %w", ErrExchangeFailed, err)
+		}
+		delay *= 2
+	}
+}
+
+// retryable reports whether the exchange failure err may be transient:
+// a network error or a response with status 429 or 5xx.
+// Other responses, such as invalid_grant, will not change on retry.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var re *oauth.RetrieveError
+	if errors.As(err, &re) {
+		if re.Response == nil {
+			return false
+		}
+		code := re.Response.StatusCode
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	return true
+}
+
+// checkDomain reports an error if WithHostedDomain is set
+// and the ID token returned with tok is not for an account in the domain.
+// The ID token comes directly from the token endpoint over HTTPS,
+// so its claims can be trusted without checking its signature.
+func (o *options) checkDomain(tok *oauth.Token) error {
+	if o.hostedDomain == "" {
+		return nil
+	}
+	c, ok := idTokenClaims(tok)
+	if !ok {
+		return fmt.Errorf("oauthprompt.Token: no ID token to check hosted domain %s; request the openid or email scope", o.hostedDomain)
+	}
+	domain := c.HostedDomain
+	if domain == "" && o.emailDomain && !isGoogleIssuer(c.Issuer) && (c.EmailVerified == true || c.EmailVerified == "true") {
+		// Google accounts outside Workspace can be registered with
+		// any email address, so only hd shows a Google account's domain.
+		if _, d, ok := strings.Cut(c.Email, "@"); ok {
+			domain = d
+		}
+	}
+	if domain == "" || !strings.EqualFold(domain, o.hostedDomain) {
+		return fmt.Errorf("oauthprompt.Token: account %s is not in hosted domain %s", c.Email, o.hostedDomain)
+	}
+	return nil
+}
+
+// isGoogleIssuer reports whether iss is Google's ID token issuer.
+func isGoogleIssuer(iss string) bool {
+	return iss == "https://accounts.google.com" || iss == "accounts.google.com"
+}
@@ -0,0 +1,668 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// AuthURL starts a local HTTP server to receive the OAuth callback and
+// returns the URL the user must visit to authorize access, leaving it to
+// the caller to present the URL. The returned wait function blocks until
+// the user completes the authorization or ctx is canceled, and then returns
+// the exchanged token. AuthURL does not read or write any cache file.
+// The caller must call wait to shut down the local server.
+func AuthURL(cfg *oauth.Config, opts ...Option) (url string, wait func(ctx context.Context) (*oauth.Token, error), err error) {
+	fl, err := Begin(cfg, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	return fl.AuthURL(), fl.Wait, nil
+}
+
+// A Flow is an authorization started by Begin.
+type Flow struct {
+	f *flow
+}
+
+// Begin is like AuthURL but returns the authorization in progress
+// as a Flow, which can also be canceled, such as from a button in a GUI.
+// The caller must call Wait or Cancel to shut down the local server.
+func Begin(cfg *oauth.Config, opts ...Option) (*Flow, error) {
+	o := newOptions(opts)
+	cfg = o.config(cfg)
+	if err := checkConfig(cfg, o); err != nil {
+		return nil, err
+	}
+	f, err := startFlow(cfg, o, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Flow{f}, nil
+}
+
+// AuthURL returns the URL the user must visit to authorize access.
+func (fl *Flow) AuthURL() string {
+	return fl.f.authURL
+}
+
+// Wait blocks until the user completes the authorization, ctx is canceled,
+// or Cancel is called, and then returns the exchanged token.
+// If Cancel is called, Wait returns an error wrapping context.Canceled.
+func (fl *Flow) Wait(ctx context.Context) (*oauth.Token, error) {
+	return fl.f.wait(ctx)
+}
+
+// Cancel abandons the authorization, shutting down the local server
+// and causing any call to Wait to return. It may be called more than once,
+// and from any goroutine.
+func (fl *Flow) Cancel() {
+	fl.f.cancelOnce.Do(func() { close(fl.f.canceled) })
+	fl.f.close()
+}
+
+// A flow is an authorization in progress, with a local HTTP server
+// waiting for the browser to be redirected back with the code.
+type flow struct {
+	cfg          *oauth.Config // copy of the caller's config, with RedirectURL set; nil for PromptForCode
+	opts         *options
+	l            net.Listener
+	srv          *http.Server // server for this flow alone, or nil
+	server       *Server      // shared server serving this flow, or nil
+	redirectURL  string       // URL of the callback
+	authURL      string       // provider URL the user must visit
+	localURL     string       // local URL redirecting to authURL
+	authPath     string       // path of localURL
+	callbackPath string       // path receiving the callback parameters
+	randState    string       // state parameter the callback must match
+	exchange     []oauth.AuthCodeOption
+	once         sync.Once // guards processing of the callback
+	ch           chan done
+	served       chan struct{} // closed when the server has stopped
+
+	cancelOnce sync.Once
+	canceled   chan struct{} // closed by Flow.Cancel
+
+	exchanged chan exchanged // outcome of the exchange, for the handler
+}
+
+type done struct {
+	err  error
+	code string
+}
+
+// exchanged is the outcome of exchanging the code from the callback.
+type exchanged struct {
+	tok *oauth.Token
+	err error
+}
+
+// PromptForCode runs the browser part of an authorization without
+// an oauth2.Config, for callers that exchange the code themselves.
+// It starts a local HTTP server to receive the callback, opens the
+// authorization URL in the user's browser, and returns the code
+// the provider sends back.
+//
+// The provider must be told the server's redirect URL, which is not known
+// until the server has started. If setRedirect is nil, PromptForCode sets
+// the redirect_uri parameter of authURL. Otherwise, it calls setRedirect
+// with the redirect URL and opens the URL it returns instead of authURL.
+// Either way, the exchange must use the same redirect URL.
+// If the URL opened has a state parameter, callbacks carrying
+// a different state are rejected.
+func PromptForCode(ctx context.Context, authURL string, setRedirect func(redirectURL string) string) (code string, err error) {
+	if setRedirect == nil {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return "", fmt.Errorf("oauthprompt.PromptForCode: %v", err)
+		}
+		setRedirect = func(redirectURL string) string {
+			q := u.Query()
+			q.Set("redirect_uri", redirectURL)
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+	}
+	opts := newOptions(nil)
+	f, err := startServer(opts, nil, setRedirect)
+	if err != nil {
+		return "", err
+	}
+	opts.logf("oauthprompt: %s", f.localURL)
+	if err := opts.openURL(f.localURL); err != nil {
+		f.close()
+		return "", err
+	}
+	return f.waitCode(ctx)
+}
+
+// startFlow starts an authorization using cfg, served by s
+// or, if s is nil, by a local HTTP server of its own.
+func startFlow(cfg *oauth.Config, opts *options, s *Server) (*flow, error) {
+	randState, err := opts.newState()
+	if err != nil {
+		return nil, err
+	}
+	authOpts, exchangeOpts, err := opts.codeOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg1 := *cfg
+	authURL := func(redirectURL string) string {
+		cfg1.RedirectURL = redirectURL
+		return cfg1.AuthCodeURL(randState, authOpts...)
+	}
+	var f *flow
+	if s != nil {
+		f, err = s.start(opts, &cfg1, authURL)
+	} else {
+		f, err = startServer(opts, &cfg1, authURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.exchange = exchangeOpts
+	opts.debugf("oauthprompt: authorization URL %s", redactURL(f.authURL))
+	return f, nil
+}
+
+// startServer starts the local HTTP server for an authorization.
+// It calls authURL with the redirect URL to obtain the URL
+// the user must visit, whose state parameter the callback must match.
+// The code is to be exchanged using cfg, or by the caller if cfg is nil.
+func startServer(opts *options, cfg *oauth.Config, authURL func(redirectURL string) string) (*flow, error) {
+	l, base, err := listenCallback(opts)
+	if err != nil {
+		return nil, err
+	}
+	f := newFlow(opts, cfg, base, authURL)
+	f.l = l
+	f.srv = &http.Server{Handler: http.HandlerFunc(f.serve)}
+	f.served = make(chan struct{})
+	go func() {
+		defer close(f.served)
+		f.srv.Serve(l)
+	}()
+	f.started()
+	return f, nil
+}
+
+// listenCallback returns the listener for the local HTTP server,
+// wrapped for TLS if requested, and the scheme and host
+// of its URLs, such as "http://127.0.0.1:12345".
+func listenCallback(opts *options) (l net.Listener, base string, err error) {
+	l, err = listen(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	scheme := "http://"
+	if opts.tlsCert != nil {
+		cert, err := tls.X509KeyPair(opts.tlsCert, opts.tlsKey)
+		if err != nil {
+			closeListener(opts, l)
+			return nil, "", fmt.Errorf("oauthprompt.Token: loading TLS certificate: %v", err)
+		}
+		l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}})
+		scheme = "https://"
+	}
+	host := opts.redirectHost
+	if host == "" {
+		if _, ok := l.Addr().(*net.TCPAddr); !ok {
+			// A Unix socket path, for example, is not a usable host.
+			closeListener(opts, l)
+			return nil, "", fmt.Errorf("oauthprompt.Token: listener address %s is not a TCP address; use WithRedirectHost", l.Addr())
+		}
+		host = l.Addr().String()
+	}
+	return l, scheme + host, nil
+}
+
+// newFlow returns a new flow for an authorization whose callback is
+// served at base, the scheme and host of the local HTTP server.
+// The caller must start serving f.serve.
+func newFlow(opts *options, cfg *oauth.Config, base string, authURL func(redirectURL string) string) *flow {
+	// The browser is sent to authPath, which redirects to the provider,
+	// which in turn redirects back to opts.redirectPath.
+	authPath := "/auth"
+	if opts.redirectPath == authPath {
+		authPath = "/start"
+	}
+	// In fragment mode, the provider puts the parameters in the fragment
+	// of the redirect URL, which the browser does not send to the server.
+	// A page served at opts.redirectPath sends them to callbackPath.
+	callbackPath := opts.redirectPath
+	if opts.fragment {
+		callbackPath = "/capture"
+		if callbackPath == opts.redirectPath || callbackPath == authPath {
+			callbackPath = "/fragment"
+		}
+	}
+
+	redirectURL := base + opts.redirectPath
+	f := &flow{
+		cfg:          cfg,
+		opts:         opts,
+		redirectURL:  redirectURL,
+		authURL:      authURL(redirectURL),
+		localURL:     base + authPath,
+		authPath:     authPath,
+		callbackPath: callbackPath,
+		ch:           make(chan done, 1),
+		canceled:     make(chan struct{}),
+		exchanged:    make(chan exchanged, 1),
+	}
+	if u, err := url.Parse(f.authURL); err == nil {
+		f.randState = u.Query().Get("state")
+	}
+	return f
+}
+
+// started reports that f is being served.
+func (f *flow) started() {
+	f.opts.debugf("oauthprompt: waiting for callback at %s", f.redirectURL)
+	if f.opts.redirectInfo != nil {
+		f.opts.redirectInfo(f.redirectURL)
+	}
+}
+
+// serve handles a request to the local HTTP server.
+func (f *flow) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == f.authPath {
+		// The local URL may be the same for every authorization,
+		// as with a Server, and the state differs each time,
+		// so the browser must not remember the redirect.
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, req, f.authURL, http.StatusFound)
+		return
+	}
+	if req.URL.Path == "/favicon.ico" {
+		// Browsers ask for this after loading the success page.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if f.opts.fragment && req.URL.Path == f.opts.redirectPath {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, fragmentBridge, f.callbackPath)
+		return
+	}
+	if req.URL.Path != f.callbackPath {
+		http.Error(w, "", 404)
+		return
+	}
+	// Only the first callback is processed. Later ones, such as from
+	// a browser's prefetch or a reload, must not affect the result.
+	first := false
+	f.once.Do(func() { first = true })
+	if !first {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(alreadyDone))
+		return
+	}
+	if err := f.opts.checkState(req.FormValue("state"), f.randState); err != nil {
+		f.send(done{err: err})
+		f.fail(w, http.StatusBadRequest, err)
+		return
+	}
+	if e := req.FormValue("error"); e != "" {
+		msg := e
+		if desc := req.FormValue("error_description"); desc != "" {
+			msg += ": " + desc
+		}
+		err := fmt.Errorf("oauthprompt.Token: %s", msg)
+		if e == "access_denied" {
+			err = fmt.Errorf("oauthprompt.Token: %w (%s)", ErrUserDenied, msg)
+		}
+		f.send(done{err: err})
+		f.fail(w, http.StatusForbidden, err)
+		return
+	}
+	if code := req.FormValue("code"); code != "" {
+		f.opts.debugf("oauthprompt: received code (%d bytes)", len(code))
+		f.send(done{code: code})
+		data := &SuccessData{AppName: f.opts.appName, AutoClose: autoCloseMillis(f.opts.autoClose)}
+		if f.cfg != nil {
+			// Wait for the exchange, so that the page
+			// can report its outcome.
+			select {
+			case x := <-f.exchanged:
+				if x.err != nil {
+					f.fail(w, http.StatusInternalServerError, x.err)
+					return
+				}
+				data.Email = idTokenEmail(x.tok)
+			case <-req.Context().Done():
+				return
+			}
+		}
+		if f.opts.successRedirectURL != "" {
+			http.Redirect(w, req, f.opts.successRedirectURL, 302)
+			return
+		}
+		if f.opts.successHTML != "" {
+			w.Write([]byte(f.opts.successHTML))
+			return
+		}
+		tmpl := f.opts.successTemplate
+		if tmpl == nil {
+			tmpl = successTemplate
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := tmpl.Execute(w, data); err != nil {
+			f.opts.logf("oauthprompt: rendering success page: %v", err)
+		}
+		return
+	}
+	err := fmt.Errorf("oauthprompt.Token: %w", ErrNoCode)
+	f.send(done{err: err})
+	f.fail(w, http.StatusBadRequest, err)
+}
+
+// listen returns the listener for the callback: opts.listener if set,
+// or else one listening on opts.listenAddr, or on one of opts.ports,
+// or on an ephemeral port on localhost.
+func listen(opts *options) (net.Listener, error) {
+	if opts.listener != nil {
+		if opts.keepListener {
+			return keepOpen(opts.listener)
+		}
+		return opts.listener, nil
+	}
+	network := opts.network
+	if network == "" {
+		network = "tcp"
+	}
+	if opts.listenAddr != "" {
+		return listenAny(network, opts.listenAddr)
+	}
+
+	if len(opts.ports) > 0 {
+		host := "127.0.0.1"
+		switch network {
+		case "tcp":
+			// Use IPv4, so that the redirect URL has the same host
+			// whichever port is chosen.
+			network = "tcp4"
+		case "tcp6":
+			host = "::1"
+		}
+		var addrs []string
+		for _, port := range opts.ports {
+			addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(port)))
+		}
+		return listenAny(network, addrs...)
+	}
+
+	switch network {
+	case "tcp4":
+		return listenAny("tcp4", "127.0.0.1:0")
+	case "tcp6":
+		return listenAny("tcp6", "[::1]:0")
+	case "tcp":
+		// Prefer IPv4, since some providers reject IPv6 redirect URLs.
+		l, err4 := net.Listen("tcp4", "127.0.0.1:0")
+		if err4 == nil {
+			return l, nil
+		}
+		l, err6 := net.Listen("tcp6", "[::1]:0")
+		if err6 != nil {
+			return nil, &ListenError{Addr: "127.0.0.1:0, [::1]:0", Err: fmt.Errorf("%w; %w", err4, err6)}
+		}
+		opts.logf("oauthprompt: using IPv6 loopback %s: %v", l.Addr(), err4)
+		return l, nil
+	}
+	return nil, fmt.Errorf("oauthprompt.Token: unsupported network %q", network)
+}
+
+// A keptListener is a listener whose Close stops Accept
+// without closing the underlying listener, for WithKeepListener.
+type keptListener struct {
+	net.Listener
+	deadline interface{ SetDeadline(time.Time) error }
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// keepOpen returns l wrapped as a keptListener.
+func keepOpen(l net.Listener) (net.Listener, error) {
+	d, ok := l.(interface{ SetDeadline(time.Time) error })
+	if !ok {
+		return nil, fmt.Errorf("oauthprompt.Token: WithKeepListener: %T has no SetDeadline method", l)
+	}
+	return &keptListener{Listener: l, deadline: d}, nil
+}
+
+func (l *keptListener) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+func (l *keptListener) Accept() (net.Conn, error) {
+	if !l.isClosed() {
+		c, err := l.Listener.Accept()
+		if !l.isClosed() {
+			return c, err
+		}
+		if c != nil {
+			c.Close()
+		}
+	}
+	return nil, net.ErrClosed
+}
+
+func (l *keptListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		l.deadline.SetDeadline(time.Now())
+	}
+	return nil
+}
+
+// closeListener closes l, which listen returned,
+// after a failure to start serving it.
+// A listener kept open by WithKeepListener is left untouched.
+func closeListener(opts *options, l net.Listener) {
+	if !opts.keepListener {
+		l.Close()
+	}
+}
+
+// releaseListener clears the deadline that closing a kept listener set
+// to interrupt Accept, so that the caller can use the listener again.
+// It must be called only once the server has stopped calling Accept.
+func releaseListener(opts *options) {
+	if opts.keepListener {
+		opts.listener.(interface{ SetDeadline(time.Time) error }).SetDeadline(time.Time{})
+	}
+}
+
+// listenAny listens on the first of addrs that is available.
+// If none is, it returns a *ListenError describing all the failures.
+func listenAny(network string, addrs ...string) (net.Listener, error) {
+	var errs []any
+	for _, addr := range addrs {
+		l, err := net.Listen(network, addr)
+		if err == nil {
+			return l, nil
+		}
+		errs = append(errs, err)
+	}
+	format := strings.Repeat("%w; ", len(errs))
+	return nil, &ListenError{
+		Addr: strings.Join(addrs, ", "),
+		Err:  fmt.Errorf(format[:len(format)-2], errs...),
+	}
+}
+
+// fail shows the error page in the browser, with the given HTTP status.
+func (f *flow) fail(w http.ResponseWriter, status int, err error) {
+	page := failure
+	if f.opts.errorHTML != "" {
+		page = f.opts.errorHTML
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(strings.ReplaceAll(page, "%s", html.EscapeString(err.Error()))))
+}
+
+// send records the result of the callback.
+// It never blocks, even if a result has already been recorded.
+func (f *flow) send(d done) {
+	select {
+	case f.ch <- d:
+	default:
+	}
+}
+
+// close shuts down the local HTTP server immediately.
+func (f *flow) close() {
+	if f.server != nil {
+		f.server.release(f)
+		return
+	}
+	f.srv.Close()
+	f.stopped()
+}
+
+// shutdown shuts down the local HTTP server, giving the handlers
+// a short time to finish sending their responses to the browser.
+func (f *flow) shutdown() {
+	if f.server != nil {
+		// Handlers still running keep their reference to f.
+		f.server.release(f)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.srv.Shutdown(ctx); err != nil {
+		f.srv.Close()
+	}
+	f.stopped()
+}
+
+// stopped waits for the server to stop, making sure that its listener
+// is closed, so that a new flow can listen on the same fixed address
+// as soon as this one returns. If the server was shut down before
+// Serve started, Serve closes the listener only when it does start.
+func (f *flow) stopped() {
+	f.l.Close()
+	<-f.served
+	releaseListener(f.opts)
+}
+
+// wait waits for the callback and exchanges the code it carries for a token.
+// It shuts down the local HTTP server before returning.
+func (f *flow) wait(ctx context.Context) (*oauth.Token, error) {
+	code, err := f.receive(ctx)
+	if err != nil {
+		f.shutdown()
+		return nil, err
+	}
+	tok, err := f.opts.exchange(f.opts.withClient(ctx), f.cfg, code, f.exchange...)
+	// Tell the handler, which is waiting to show the outcome.
+	f.exchanged <- exchanged{tok, err}
+	f.shutdown()
+	return tok, err
+}
+
+// waitCode waits for the callback and returns the code it carries.
+// It shuts down the local HTTP server before returning.
+func (f *flow) waitCode(ctx context.Context) (string, error) {
+	code, err := f.receive(ctx)
+	f.shutdown()
+	return code, err
+}
+
+// receive waits for the callback and returns the code it carries.
+// If it gives up waiting, it shuts down the local HTTP server.
+func (f *flow) receive(ctx context.Context) (string, error) {
+	var timeout <-chan time.Time
+	if f.opts.timeout > 0 {
+		t := time.NewTimer(f.opts.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	var d done
+	select {
+	case d = <-f.ch:
+	case <-ctx.Done():
+		f.close()
+		return "", ctx.Err()
+	case <-f.canceled:
+		f.close()
+		return "", fmt.Errorf("oauthprompt.Token: %w", context.Canceled)
+	case <-timeout:
+		f.close()
+		return "", fmt.Errorf("oauthprompt.Token: %w", ErrTimeout)
+	}
+	if d.err != nil {
+		return "", d.err
+	}
+	return d.code, nil
+}
+
+// autoCloseMillis returns the delay d in milliseconds for SuccessData.AutoClose:
+// 0 if d is zero or negative, disabling the attempt to close the page,
+// and otherwise at least 1, so that a tiny delay does not disable it.
+func autoCloseMillis(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return max(d.Milliseconds(), 1)
+}
+
+// idTokenEmail returns the email address in the OpenID Connect ID token
+// returned with tok, if any. The ID token is not verified, so the address
+// is suitable only for showing to the user.
+func idTokenEmail(tok *oauth.Token) string {
+	c, _ := idTokenClaims(tok)
+	return c.Email
+}
+
+// idClaims are the OpenID Connect ID token claims used by this package.
+type idClaims struct {
+	Issuer        string `json:"iss"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"` // a bool, or a string for some providers
+	HostedDomain  string `json:"hd"`
+}
+
+// idTokenClaims returns the claims in the ID token returned with tok,
+// and whether there is one.
+func idTokenClaims(tok *oauth.Token) (idClaims, bool) {
+	var claims idClaims
+	id, _ := tok.Extra("id_token").(string)
+	parts := strings.Split(id, ".")
+	if len(parts) != 3 {
+		return claims, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return claims, false
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, false
+	}
+	return claims, true
+}
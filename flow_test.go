@@ -0,0 +1,188 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnixListener(t *testing.T) {
+	var exchanges int
+	cfg := testProvider(t, &exchanges)
+	sock := filepath.Join(t.TempDir(), "sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	_, err = Begin(cfg, WithListener(l), WithLogger(t.Logf))
+	if err == nil || !strings.Contains(err.Error(), "WithRedirectHost") {
+		t.Fatalf("Begin with unix listener: err = %v, want mention of WithRedirectHost", err)
+	}
+
+	l, err = net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl, err := Begin(cfg, WithListener(l), WithRedirectHost("localhost:9999"), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(fl.AuthURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if got, want := q.Get("redirect_uri"), "http://localhost:9999/done"; got != want {
+		t.Errorf("redirect_uri = %q, want %q", got, want)
+	}
+
+	// Deliver the callback over the socket, whatever the URL's host.
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+		DisableKeepAlives: true,
+	}}
+	go func() {
+		resp, err := client.Get(q.Get("redirect_uri") + "?code=good&state=" + url.QueryEscape(q.Get("state")))
+		if err != nil {
+			t.Errorf("callback: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+	tok, err := fl.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != "token1" {
+		t.Errorf("token = %q, want token1", tok.AccessToken)
+	}
+}
+
+func TestKeepListener(t *testing.T) {
+	var exchanges int
+	cfg := testProvider(t, &exchanges)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	for i := range 2 {
+		fl, err := Begin(cfg, WithListener(l), WithKeepListener(true), WithLogger(t.Logf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(fl.AuthURL())
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		go func() {
+			resp, err := client.Get(q.Get("redirect_uri") + "?code=good&state=" + url.QueryEscape(q.Get("state")))
+			if err != nil {
+				t.Errorf("callback: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+		if _, err := fl.Wait(context.Background()); err != nil {
+			t.Fatalf("authorization %d: %v", i+1, err)
+		}
+	}
+	if exchanges != 2 {
+		t.Errorf("%d exchanges, want 2", exchanges)
+	}
+}
+
+// checkUsable checks that l still accepts connections.
+func checkUsable(t *testing.T, l net.Listener) {
+	t.Helper()
+	go func() {
+		c, err := net.Dial(l.Addr().Network(), l.Addr().String())
+		if err == nil {
+			c.Close()
+		}
+	}()
+	accepted := make(chan error, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			c.Close()
+		}
+		accepted <- err
+	}()
+	select {
+	case err := <-accepted:
+		if err != nil {
+			t.Fatalf("listener unusable after flow: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("listener unusable after flow: Accept timed out")
+	}
+}
+
+func TestKeepListenerBeginFails(t *testing.T) {
+	var exchanges int
+	cfg := testProvider(t, &exchanges)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, err = Begin(cfg, WithListener(l), WithKeepListener(true), WithTLS([]byte("bad"), []byte("bad")), WithLogger(t.Logf))
+	if err == nil {
+		t.Fatal("Begin with bad certificate succeeded")
+	}
+	checkUsable(t, l)
+
+	u, err := net.Listen("unix", filepath.Join(t.TempDir(), "sock"))
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer u.Close()
+	if _, err := Begin(cfg, WithListener(u), WithKeepListener(true), WithLogger(t.Logf)); err == nil {
+		t.Fatal("Begin with unix listener and no WithRedirectHost succeeded")
+	}
+	checkUsable(t, u)
+}
+
+func TestKeepListenerCancel(t *testing.T) {
+	var exchanges int
+	cfg := testProvider(t, &exchanges)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for range 20 {
+		fl, err := Begin(cfg, WithListener(l), WithKeepListener(true), WithLogger(t.Logf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fl.Cancel()
+		checkUsable(t, l)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fl, err := Begin(cfg, WithListener(l), WithKeepListener(true), WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fl.Wait(ctx); err == nil {
+		t.Fatal("Wait with canceled context succeeded")
+	}
+	checkUsable(t, l)
+}
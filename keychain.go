@@ -0,0 +1,49 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// KeychainStore returns a Store that keeps the token in the system's
+// credential store under the given service and account names:
+// the Keychain on macOS, the Credential Manager on Windows,
+// and the Secret Service, using the secret-tool command, on other Unix systems.
+// On systems without a supported credential store,
+// the store's methods return errors.
+func KeychainStore(service, account string) Store {
+	return &keychainStore{service, account}
+}
+
+// A keychainStore is a Store that keeps the token in the system's
+// credential store, using the per-system functions keychainGet and keychainSet.
+type keychainStore struct {
+	service string
+	account string
+}
+
+func (s *keychainStore) Load() (*oauth.Token, error) {
+	data, err := keychainGet(s.service, s.account)
+	if err != nil {
+		return nil, err
+	}
+	tok := new(oauth.Token)
+	if err := json.Unmarshal(data, tok); err != nil {
+		return nil, fmt.Errorf("oauthprompt: unmarshal keychain token %s/%s: %v", s.service, s.account, err)
+	}
+	return tok, nil
+}
+
+func (s *keychainStore) Save(tok *oauth.Token) error {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	return keychainSet(s.service, s.account, data)
+}
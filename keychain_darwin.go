@@ -0,0 +1,56 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strings"
+)
+
+// keychainGet returns the generic password stored in the macOS Keychain
+// for service and account, using the security command.
+func keychainGet(service, account string) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if err != nil {
+		// security exits with status 44 when there is no such item.
+		var ee *exec.ExitError
+		if errors.As(err, &ee) && ee.ExitCode() == 44 {
+			return nil, fmt.Errorf("oauthprompt: keychain %s/%s: %w", service, account, fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("oauthprompt: keychain %s/%s: %v", service, account, err)
+	}
+	return bytes.TrimSuffix(out, []byte("\n")), nil
+}
+
+// keychainSet stores data as the generic password in the macOS Keychain
+// for service and account, replacing any existing one.
+// The security command accepts the password only as an argument,
+// which other processes could see, so the command is sent on standard
+// input, to security's interactive mode, instead of on the command line.
+func keychainSet(service, account string, data []byte) error {
+	line := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %x\n", securityQuote(service), securityQuote(account), data)
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(line)
+	out, err := cmd.CombinedOutput()
+	// In interactive mode, security prints a prompt before each command
+	// and reports a failing command only by printing an error.
+	msg := strings.TrimSpace(strings.ReplaceAll(string(out), "security> ", ""))
+	if err == nil && msg != "" {
+		err = errors.New("add-generic-password failed")
+	}
+	if err != nil {
+		return fmt.Errorf("oauthprompt: keychain %s/%s: %v\n%s", service, account, err, msg)
+	}
+	return nil
+}
+
+// securityQuote quotes s as an argument for security's interactive mode.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,17 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package oauthprompt
+
+import "fmt"
+
+func keychainGet(service, account string) ([]byte, error) {
+	return nil, fmt.Errorf("oauthprompt: no credential store on this system")
+}
+
+func keychainSet(service, account string, data []byte) error {
+	return fmt.Errorf("oauthprompt: no credential store on this system")
+}
@@ -0,0 +1,54 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build dragonfly || freebsd || linux || netbsd || openbsd
+
+package oauthprompt
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os/exec"
+)
+
+// keychainGet returns the secret stored in the Secret Service
+// (such as GNOME Keyring or KWallet) for service and account,
+// using the libsecret secret-tool command.
+func keychainGet(service, account string) ([]byte, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", service, "account", account).Output()
+	if err != nil {
+		// secret-tool prints nothing and exits with status 1
+		// when there is no such secret. Other failures, such as
+		// a missing D-Bus session or a locked keyring, print a
+		// message, which must be reported now: treating them as
+		// no secret would ask the user to authorize access only
+		// for saving the token to fail afterward.
+		ee, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("oauthprompt: secret service %s/%s: %v", service, account, err)
+		}
+		msg := bytes.TrimSpace(ee.Stderr)
+		if ee.ExitCode() != 1 || len(msg) > 0 {
+			return nil, fmt.Errorf("oauthprompt: secret service %s/%s: %v: %s", service, account, err, msg)
+		}
+		out = nil
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("oauthprompt: secret service %s/%s: %w", service, account, fs.ErrNotExist)
+	}
+	return out, nil
+}
+
+// keychainSet stores data in the Secret Service for service and account,
+// replacing any existing secret.
+func keychainSet(service, account string, data []byte) error {
+	cmd := exec.Command("secret-tool", "store", "--label=oauthprompt "+service, "service", service, "account", account)
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("oauthprompt: secret service %s/%s: %v\n%s", service, account, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build dragonfly || freebsd || linux || netbsd || openbsd
+
+package oauthprompt
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeychainGetErrors(t *testing.T) {
+	tests := []struct {
+		script  string
+		secret  string
+		missing bool
+		err     string
+	}{
+		{script: "printf secret", secret: "secret"},
+		{script: "exit 1", missing: true},
+		{script: "echo 'Cannot autolaunch D-Bus without X11 $DISPLAY' >&2; exit 1", err: "D-Bus"},
+		{script: "echo locked >&2; exit 2", err: "locked"},
+	}
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	for _, tt := range tests {
+		script := "#!/bin/sh\n" + tt.script + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data, err := keychainGet("svc", "acct")
+		switch {
+		case tt.err != "":
+			if err == nil || errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: err = %v, want error mentioning %q, not fs.ErrNotExist", tt.script, err, tt.err)
+			}
+		case tt.missing:
+			if !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%q: err = %v, want fs.ErrNotExist", tt.script, err)
+			}
+		case err != nil || string(data) != tt.secret:
+			t.Errorf("%q: keychainGet = %q, %v, want %q, nil", tt.script, data, err, tt.secret)
+		}
+	}
+}
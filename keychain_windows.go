@@ -0,0 +1,98 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modadvapi32    = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = modadvapi32.NewProc("CredReadW")
+	procCredWriteW = modadvapi32.NewProc("CredWriteW")
+	procCredFree   = modadvapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// credential is the Windows CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credTarget returns the Credential Manager target name for service and account.
+func credTarget(service, account string) string {
+	return service + ":" + account
+}
+
+// keychainGet returns the generic credential stored in the
+// Windows Credential Manager for service and account.
+func keychainGet(service, account string) ([]byte, error) {
+	target, err := syscall.UTF16PtrFromString(credTarget(service, account))
+	if err != nil {
+		return nil, err
+	}
+	var cred *credential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		if err == errorNotFound {
+			return nil, fmt.Errorf("oauthprompt: credential %s: %w", credTarget(service, account), fs.ErrNotExist)
+		}
+		return nil, fmt.Errorf("oauthprompt: credential %s: %v", credTarget(service, account), err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	data := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+	return append([]byte(nil), data...), nil
+}
+
+// keychainSet stores data as the generic credential in the
+// Windows Credential Manager for service and account, replacing any existing one.
+// The Credential Manager limits credentials to 2560 bytes,
+// which may be too small for some providers' tokens.
+func keychainSet(service, account string, data []byte) error {
+	target, err := syscall.UTF16PtrFromString(credTarget(service, account))
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+	var blob *byte
+	if len(data) > 0 {
+		blob = &data[0]
+	}
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(data)),
+		CredentialBlob:     blob,
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if r == 0 {
+		return fmt.Errorf("oauthprompt: credential %s: %v", credTarget(service, account), err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package oauthprompt
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lockPoll is how often lockFile retries a lock held by another process.
+const lockPoll = 100 * time.Millisecond
+
+// lockFile acquires an exclusive advisory lock on the named file,
+// creating it with permissions perm if necessary, and returns a function
+// that releases the lock. The holder may be waiting for the user to
+// authorize access, possibly for a long time, so lockFile polls for the
+// lock and gives up when ctx is done.
+//
+// The file is opened read-only, which suffices for flock, so that anyone
+// who can read a cache file shared using WithTokenFilePerm can lock it.
+func lockFile(ctx context.Context, name string, perm os.FileMode) (unlock func(), err error) {
+	f, err := os.OpenFile(name, os.O_RDONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err == nil && perm != 0600 {
+		// As in writeFile, set perm explicitly, whatever the umask.
+		if err := f.Chmod(perm); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if os.IsExist(err) {
+		f, err = os.Open(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != syscall.EWOULDBLOCK {
+			f.Close()
+			return nil, err
+		}
+		t := time.NewTimer(lockPoll)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			f.Close()
+			return nil, context.Cause(ctx)
+		}
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
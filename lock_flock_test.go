@@ -0,0 +1,43 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package oauthprompt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockFilePerm(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "token.lock")
+	unlock, err := lockFile(context.Background(), name, 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0640 {
+		t.Errorf("lock file mode = %#o, want 0640", perm)
+	}
+
+	// A group member sharing the token can only read the lock file.
+	if os.Getuid() == 0 {
+		t.Skip("root can open any file for writing")
+	}
+	if err := os.Chmod(name, 0400); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = lockFile(context.Background(), name, 0640)
+	if err != nil {
+		t.Fatalf("locking read-only lock file: %v", err)
+	}
+	unlock()
+}
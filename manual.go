@@ -0,0 +1,64 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// oobRedirectURL is the redirect URL asking the provider to display
+// the authorization code to the user instead of redirecting the browser.
+const oobRedirectURL = "urn:ietf:wg:oauth:2.0:oob"
+
+// manualToken obtains a token by asking the user to visit the authorization
+// URL and paste the resulting code into the terminal.
+func manualToken(ctx context.Context, cfg *oauth.Config, opts *options) (*oauth.Token, error) {
+	randState, err := opts.newState()
+	if err != nil {
+		return nil, err
+	}
+	authOpts, exchangeOpts, err := opts.codeOptions()
+	if err != nil {
+		return nil, err
+	}
+	cfg1 := *cfg
+	cfg1.RedirectURL = oobRedirectURL
+	authURL := cfg1.AuthCodeURL(randState, authOpts...)
+	if opts.redirectInfo != nil {
+		opts.redirectInfo(cfg1.RedirectURL)
+	}
+	opts.debugf("oauthprompt: authorization URL %s", redactURL(authURL))
+
+	var in io.Reader = os.Stdin
+	var out io.Writer = os.Stderr
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+		in, out = tty, tty
+	}
+
+	if opts.onAuthURL != nil {
+		opts.onAuthURL(authURL)
+	}
+	if opts.qrCode {
+		showQR(out, authURL)
+	}
+	fmt.Fprintf(out, "To log in, please visit %s\nEnter the authorization code: ", authURL)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	code := strings.TrimSpace(line)
+	if code == "" {
+		if err == nil {
+			err = fmt.Errorf("no code entered")
+		}
+		return nil, fmt.Errorf("oauthprompt.Token: reading authorization code: %v", err)
+	}
+	return opts.exchange(ctx, &cfg1, code, exchangeOpts...)
+}
@@ -9,109 +9,316 @@ package oauthprompt
 import (
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"io"
-	"net"
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
-	"golang.org/x/oauth2"
 	oauth "golang.org/x/oauth2"
 )
 
 // Token obtains an OAuth token, keeping a cached copy in file.
-// If the file name is not an absolute path, it is interpreted relative to the
-// user's home directory.
+// If the file name is not an absolute path, it is interpreted relative to
+// $XDG_CACHE_HOME if that is set, or else the user's home directory.
+// An existing file in the home directory is used in preference to one
+// in $XDG_CACHE_HOME.
+// If the cached token was obtained for a different client or provider,
+// or for a set of scopes that does not include all of cfg.Scopes,
+// Token prompts the user again. An OpenID Connect ID token returned
+// with the token is cached with it and available from the tokens
+// returned by this package as tok.Extra("id_token").
 func Token(file string, cfg *oauth.Config) (*http.Client, error) {
-	if !filepath.IsAbs(file) {
-		file = filepath.Join(os.Getenv("HOME"), file)
-	}
-	data, err := os.ReadFile(file)
-	if err == nil {
-		var tok oauth.Token
-		if err := json.Unmarshal(data, &tok); err != nil {
-			return nil, fmt.Errorf("oauthprompt.Token: unmarshal %s: %v", file, err)
-		}
-		return cfg.Client(context.Background(), &tok), nil
-	}
+	return TokenWithOptions(file, cfg)
+}
+
+// TokenContext is like Token but uses ctx for the token exchange and
+// the returned client. If ctx is canceled while waiting for the user
+// to complete the authorization in the browser, TokenContext returns ctx.Err().
+func TokenContext(ctx context.Context, file string, cfg *oauth.Config) (*http.Client, error) {
+	return TokenWithOptions(file, cfg, WithContext(ctx))
+}
+
+// TokenTimeout is like Token but gives up and returns an error if the user
+// has not completed the authorization in the browser within the timeout.
+func TokenTimeout(timeout time.Duration, file string, cfg *oauth.Config) (*http.Client, error) {
+	return TokenWithOptions(file, cfg, WithTimeout(timeout))
+}
 
-	// Start HTTP server on localhost.
-	l, err := net.Listen("tcp", "127.0.0.1:0")
+// TokenSource is like Token but returns a token source instead of a client,
+// for use with other APIs built on golang.org/x/oauth2.
+// Tokens obtained by refreshing are written back to file.
+func TokenSource(file string, cfg *oauth.Config) (oauth.TokenSource, error) {
+	_, ts, err := token(file, cfg, newOptions(nil))
+	return ts, err
+}
+
+// TokenNoCache is like Token but neither reads nor writes a cache file:
+// it always asks the user to authorize access, and the token is kept
+// only in memory by the returned client.
+func TokenNoCache(cfg *oauth.Config) (*http.Client, error) {
+	opts := newOptions(nil)
+	_, ts, err := cachedToken(noCache{}, cfg, opts)
 	if err != nil {
-		var err1 error
-		if l, err1 = net.Listen("tcp6", "[::1]:0"); err1 != nil {
-			return nil, fmt.Errorf("oauthprompt.Token: starting HTTP server: %v", err)
-		}
+		return nil, err
 	}
+	return oauth.NewClient(opts.ctx, ts), nil
+}
+
+// ExchangeCode is like TokenContext but, instead of asking the user to
+// authorize access, exchanges code, an authorization code obtained by the
+// caller, such as from a callback captured by another system. The exchange
+// uses cfg.RedirectURL, which must match the one used to obtain the code.
+// The resulting token replaces any token cached in file.
+func ExchangeCode(ctx context.Context, file string, cfg *oauth.Config, code string) (*http.Client, error) {
+	return TokenWithOptions(file, cfg, WithContext(ctx), func(o *options) {
+		o.code = code
+		o.forceReauth = true
+	})
+}
 
-	type done struct {
-		err  error
-		code string
+// TokenAndClient is like Token but also returns the token itself,
+// so that callers can inspect its expiry or use the access token directly.
+func TokenAndClient(file string, cfg *oauth.Config) (*oauth.Token, *http.Client, error) {
+	opts := newOptions(nil)
+	res, ts, err := token(file, cfg, opts)
+	if err != nil {
+		return nil, nil, err
 	}
-	ch := make(chan done, 100)
+	return res.Token, oauth.NewClient(opts.ctx, ts), nil
+}
+
+// A Result describes the outcome of TokenResult.
+type Result struct {
+	Token  *oauth.Token // the token obtained
+	Client *http.Client // a client using the token and refreshing it as needed
+
+	// Cached reports whether the token was obtained without asking
+	// the user, from the cache file or from the environment variable
+	// named by WithEnvToken.
+	Cached bool
+
+	// RedirectURL is the redirect URL sent to the provider
+	// when the user was asked to authorize access, or else "".
+	RedirectURL string
+
+	// UserInfo is the decoded response from the endpoint set by
+	// WithUserInfoURL, fetched when the user authorized access and
+	// cached with the token. It is nil if WithUserInfoURL was not used
+	// or the request failed.
+	UserInfo map[string]any
+
+	// Email is the user's email address, from UserInfo
+	// or else from the OpenID Connect ID token, if either has one.
+	Email string
+}
 
-	randState, err := randomID()
+// TokenResult is like TokenWithOptions but returns the token and client
+// together with details about how they were obtained.
+func TokenResult(file string, cfg *oauth.Config, opts ...Option) (*Result, error) {
+	o := newOptions(opts)
+	res, ts, err := token(file, cfg, o)
 	if err != nil {
 		return nil, err
 	}
+	res.Client = oauth.NewClient(o.ctx, ts)
+	return res, nil
+}
 
-	cfg1 := *cfg
-	cfg = &cfg1
-	cfg.RedirectURL = "http://" + l.Addr().String() + "/done"
-	authURL := cfg1.AuthCodeURL(randState)
+// token obtains a token, from the cache file if possible,
+// and returns it along with a source that refreshes it as needed.
+// The Client field of the result is left for the caller to set.
+func token(file string, cfg *oauth.Config, opts *options) (*Result, oauth.TokenSource, error) {
+	if opts.cacheDisabled {
+		return cachedToken(memoryCache(cfg), cfg, opts)
+	}
+	file, err := cacheFile(file, opts.xdg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cachedToken(opts.fileCache(file), cfg, opts)
+}
+
+// cachedToken obtains a token, from cache if possible,
+// and returns it along with a source that refreshes it as needed.
+// The Client field of the result is left for the caller to set.
+func cachedToken(cache cache, cfg *oauth.Config, opts *options) (*Result, oauth.TokenSource, error) {
+	ctx := opts.ctx
+	cfg = opts.config(cfg)
 
-	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		if req.URL.Path == "/auth" {
-			http.Redirect(w, req, authURL, 301)
-			return
+	if err := checkConfig(cfg, opts); err != nil {
+		return nil, nil, err
+	}
+	if opts.readOnly {
+		cache = readOnlyCache{cache, opts.logf}
+	}
+
+	if opts.envToken != "" {
+		if v := os.Getenv(opts.envToken); v != "" {
+			tok, ts, err := envToken(ctx, cfg, opts.envToken, v)
+			if err != nil {
+				return nil, nil, err
+			}
+			return &Result{Token: tok, Cached: true}, ts, nil
 		}
-		if req.URL.Path != "/done" {
-			http.Error(w, "", 404)
-			return
+	}
+
+	// Hold a lock while reading, prompting, and writing, so that concurrent
+	// callers sharing the cache wait for one prompt instead of each
+	// starting their own. The wait for another caller's prompt
+	// is bounded by the context and timeout, like the prompt itself.
+	lockCtx := ctx
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithTimeoutCause(ctx, opts.timeout, ErrTimeout)
+		defer cancel()
+	}
+	unlock, err := cache.lock(lockCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	if !opts.forceReauth {
+		c, err := cache.load()
+		if err != nil {
+			return nil, nil, err
 		}
-		if req.FormValue("state") != randState {
-			ch <- done{err: fmt.Errorf("oauthprompt.Token: incorrect response")}
-			http.Error(w, "", 500)
-			return
+		if c != nil {
+			// An expired token that cannot be refreshed is useless,
+			// as is an empty one, such as "{}" left by a damaged
+			// cache file; prompt for a new one instead.
+			if !c.expired() && c.matches(cfg) && c.covers(cfg.Scopes) && !c.olderThan(opts.maxAge) && opts.checkDomain(&c.Token) == nil {
+				if !c.expiresWithin(opts.minValidity) {
+					return c.result(true), newCachingTokenSource(ctx, cache, cfg, c, opts), nil
+				}
+				// The token is about to expire: refresh it now so that
+				// the caller starts with a full lifetime. If that is not
+				// possible, prompt for a new one.
+				if c.RefreshToken != "" {
+					tok, err := cfg.TokenSource(ctx, &oauth.Token{RefreshToken: c.RefreshToken}).Token()
+					if err == nil {
+						c.setToken(tok)
+						if err := cache.save(c); err != nil {
+							return nil, nil, err
+						}
+						opts.notify(tok)
+						return c.result(true), newCachingTokenSource(ctx, cache, cfg, c, opts), nil
+					}
+					opts.logf("oauthprompt: refreshing token: %v", err)
+				}
+			}
 		}
-		if code := req.FormValue("code"); code != "" {
-			ch <- done{code: code}
-			w.Write([]byte(success))
-			return
+	}
+
+	// Note the redirect URL for the result,
+	// while still reporting it to the caller's redirectInfo.
+	var redirectURL string
+	prompt := *opts
+	prompt.redirectInfo = func(url string) {
+		redirectURL = url
+		if opts.redirectInfo != nil {
+			opts.redirectInfo(url)
 		}
-		http.Error(w, "", 500)
-	})
+	}
 
-	srv := &http.Server{Handler: handler}
-	go srv.Serve(l)
-	if err := openURL("http://" + l.Addr().String() + "/auth"); err != nil {
-		l.Close()
-		return nil, err
+	var tok *oauth.Token
+	switch {
+	case opts.code != "":
+		tok, err = opts.exchange(ctx, cfg, opts.code, opts.exchangeOptions...)
+	case opts.device:
+		tok, err = deviceToken(ctx, cfg, &prompt)
+	case opts.manualCode:
+		tok, err = manualToken(ctx, cfg, &prompt)
+	default:
+		tok, err = browserToken(ctx, cfg, &prompt)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
-	d := <-ch
-	l.Close()
 
-	if d.err != nil {
-		return nil, err
+	// Record the scopes even if there are none,
+	// to distinguish this file from one written by an older version.
+	c := &cacheEntry{
+		Token:       *tok,
+		Scopes:      append([]string{}, cfg.Scopes...),
+		Fingerprint: fingerprint(cfg),
+		IssuedAt:    timeNow(),
+	}
+	if opts.userInfoURL != "" {
+		// The token is good even if the user info is not.
+		if c.UserInfo, err = userInfo(ctx, opts.userInfoURL, tok); err != nil {
+			opts.logf("oauthprompt: %v", err)
+		}
+	}
+	if err := cache.save(c); err != nil {
+		return nil, nil, err
 	}
+	opts.notify(tok)
+	res := c.result(false)
+	res.RedirectURL = redirectURL
+	return res, newCachingTokenSource(ctx, cache, cfg, c, opts), nil
+}
 
-	tok, err := cfg.Exchange(context.Background(), d.code)
-	if err != nil {
-		return nil, err
+// checkConfig reports an error if cfg lacks settings needed to obtain
+// a token, so that the mistake is reported before a browser is opened
+// on the provider's error page.
+func checkConfig(cfg *oauth.Config, opts *options) error {
+	switch {
+	case cfg.ClientID == "":
+		return fmt.Errorf("oauthprompt.Token: invalid config: no ClientID")
+	case cfg.Endpoint.AuthURL == "" && !opts.device && opts.code == "":
+		return fmt.Errorf("oauthprompt.Token: invalid config: no Endpoint.AuthURL")
+	case cfg.Endpoint.TokenURL == "":
+		return fmt.Errorf("oauthprompt.Token: invalid config: no Endpoint.TokenURL")
 	}
+	return nil
+}
 
-	data, err = json.Marshal(tok)
+// envToken returns the token described by the value v of the
+// environment variable name: either a JSON-encoded oauth.Token
+// or a bare access token.
+func envToken(ctx context.Context, cfg *oauth.Config, name, v string) (*oauth.Token, oauth.TokenSource, error) {
+	if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+		tok := &oauth.Token{AccessToken: strings.TrimSpace(v), TokenType: "Bearer"}
+		return tok, oauth.StaticTokenSource(tok), nil
+	}
+	tok := new(oauth.Token)
+	if err := json.Unmarshal([]byte(v), tok); err != nil {
+		return nil, nil, fmt.Errorf("oauthprompt.Token: unmarshal $%s: %v", name, err)
+	}
+	return tok, cfg.TokenSource(ctx, tok), nil
+}
+
+// browserToken obtains a token by sending the user's browser
+// to the authorization URL and waiting for the callback.
+func browserToken(ctx context.Context, cfg *oauth.Config, opts *options) (*oauth.Token, error) {
+	f, err := startFlow(cfg, opts, nil)
 	if err != nil {
 		return nil, err
 	}
-	if err := os.WriteFile(file, data, 0666); err != nil {
-		return nil, err
+	if opts.qrCode {
+		// The local URL is useless on another device,
+		// so show the provider's URL instead.
+		showQR(os.Stderr, f.authURL)
 	}
-
-	return cfg.Client(context.Background(), tok), nil
+	opts.logf("oauthprompt: %s", f.localURL)
+	if opts.onAuthURL != nil {
+		opts.onAuthURL(f.authURL)
+	}
+	if !opts.noBrowser {
+		if err := opts.openURL(f.localURL); err != nil {
+			f.close()
+			return nil, err
+		}
+	}
+	return f.wait(ctx)
 }
 
 var browsers = []string{
@@ -120,15 +327,129 @@ var browsers = []string{
 	"open", // for OS X
 }
 
-func openURL(url string) error {
-	fmt.Fprintf(os.Stderr, "oauthprompt: %s\n", url)
+// browserCommands returns the commands to try, in order, to open url.
+// Entries in $BROWSER, a colon-separated list of commands, are tried first.
+// A %s in a $BROWSER entry is replaced by url; otherwise url is appended.
+// On Linux without a graphical display, the graphical browsers are skipped,
+// leaving the user to visit the URL by hand.
+func browserCommands(url string) [][]string {
+	var cmds [][]string
+	for _, entry := range strings.Split(os.Getenv("BROWSER"), ":") {
+		if args := strings.Fields(entry); len(args) > 0 {
+			cmds = append(cmds, withURL(args, url))
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return append(cmds,
+			[]string{"rundll32", "url.dll,FileProtocolHandler", url},
+			[]string{"cmd", "/c", "start", "", strings.ReplaceAll(url, "&", "^&")},
+		)
+	}
+	if runtime.GOOS == "linux" && isWSL() {
+		cmds = append(cmds,
+			[]string{"wslview", url},
+			[]string{"powershell.exe", "-NoProfile", "-Command", "Start-Process '" + strings.ReplaceAll(url, "'", "''") + "'"},
+		)
+	}
+	if runtime.GOOS == "linux" && os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		// Launching them would fail, perhaps slowly,
+		// or show the page on some other screen.
+		return cmds
+	}
 	for _, browser := range browsers {
-		err := exec.Command(browser, url).Run()
-		if err == nil {
+		cmds = append(cmds, []string{browser, url})
+	}
+	return cmds
+}
+
+// withURL returns the command args with each %s replaced by url,
+// or with url appended if there is no %s.
+func withURL(args []string, url string) []string {
+	var out []string
+	found := false
+	for _, arg := range args {
+		if strings.Contains(arg, "%s") {
+			found = true
+			arg = strings.ReplaceAll(arg, "%s", url)
+		}
+		out = append(out, arg)
+	}
+	if !found {
+		out = append(out, url)
+	}
+	return out
+}
+
+// isWSL reports whether the program is running under the
+// Windows Subsystem for Linux.
+func isWSL() bool {
+	data, err := os.ReadFile("/proc/version")
+	return err == nil && strings.Contains(strings.ToLower(string(data)), "microsoft")
+}
+
+// openURL opens url in the user's browser. It is the default for
+// WithBrowser, and tests may replace it to drive the flow without a browser.
+var openURL = openBrowser
+
+// openBrowser opens url using the first of browserCommands that succeeds,
+// or else asks the user to visit it.
+func openBrowser(url string) error {
+	for _, cmd := range browserCommands(url) {
+		if launch(cmd) == nil {
 			return nil
 		}
 	}
 
+	// Without a terminal, such as in a daemon with standard error
+	// redirected to a file, nobody would see the URL,
+	// and the flow would wait forever.
+	if !interactive() {
+		return fmt.Errorf("oauthprompt.Token: %w and no interactive terminal; use WithDeviceFlow or WithManualCode", ErrNoBrowser)
+	}
+	return tellUser("To log in, please visit %s\n", url)
+}
+
+// launchWait is how long launch waits for a launcher to exit.
+var launchWait = 2 * time.Second
+
+// launch runs the command args to open a URL. Some launchers exit as soon
+// as the browser has the URL, but others, such as a browser started fresh,
+// keep running, so launch waits only briefly: a launcher that fails
+// within launchWait is reported as failing, and one that is still running
+// is assumed to have succeeded and is left to exit on its own.
+// Either way the process is waited for, so that it does not linger
+// as a zombie, and a hung launcher delays the flow by at most launchWait.
+func launch(args []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	t := time.NewTimer(launchWait)
+	defer t.Stop()
+	select {
+	case err := <-exited:
+		return err
+	case <-t.C:
+		return nil
+	}
+}
+
+// interactive reports whether there is a terminal
+// on which to show messages for the user.
+func interactive() bool {
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		tty.Close()
+		return true
+	}
+	fi, err := os.Stderr.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// tellUser prints a message for the user on the terminal.
+func tellUser(format string, args ...any) error {
 	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
 	if err != nil {
 		// Hope for the best with standard error.
@@ -137,48 +458,100 @@ func openURL(url string) error {
 		defer tty.Close()
 	}
 
-	_, err = fmt.Fprintf(tty, "To log in, please visit %s\n", url)
+	_, err = fmt.Fprintf(tty, format, args...)
 	if err != nil {
 		return fmt.Errorf("failed to notify user about URL")
 	}
 	return nil
 }
 
-// GoogleToken is like Token but assumes the Google AuthURL and TokenURL,
-// so that only the client ID and secret and desired scope must be specified.
-func GoogleToken(file, clientID, clientSecret string, scopes ...string) (*http.Client, error) {
-	cfg := &oauth.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		Scopes:       scopes,
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  "https://accounts.google.com/o/oauth2/auth",
-			TokenURL: "https://accounts.google.com/o/oauth2/token",
-		},
-	}
-	return Token(file, cfg)
-}
+// randReader is the source of randomness for state values and
+// PKCE verifiers. Tests may replace it with a deterministic reader.
+var randReader io.Reader = rand.Reader
 
-func randomID() (string, error) {
-	buf := make([]byte, 16)
-	_, err := io.ReadFull(rand.Reader, buf)
+// randomID returns a random hexadecimal string encoding n bytes.
+func randomID(n int) (string, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(randReader, buf)
 	if err != nil {
 		return "", fmt.Errorf("RandomID: reading rand.Reader: %v", err)
 	}
 	return fmt.Sprintf("%x", buf), nil
 }
 
-var success = `<html>
+// newVerifier returns a new PKCE code verifier, as defined in RFC 7636.
+func newVerifier() (string, error) {
+	buf := make([]byte, 32)
+	_, err := io.ReadFull(randReader, buf)
+	if err != nil {
+		return "", fmt.Errorf("newVerifier: reading rand.Reader: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// SuccessData is the data for the template set by WithSuccessTemplate.
+type SuccessData struct {
+	AppName   string // name set by WithAppName
+	Email     string // email address of the account authorized, if known
+	AutoClose int64  // milliseconds before the page should close itself; 0 means never
+}
+
+// successTemplate is the default success page.
+var successTemplate = template.Must(template.New("success").Parse(`<html>
 <head>
 <title>Authenticated</title>
-<script>
+{{if .AutoClose}}<script>
 function done() {
-	setTimeout(function() {window.close()}, 5000)
+	setTimeout(function() {window.close()}, {{.AutoClose}})
 }
 </script>
+{{end}}</head>
+<body{{if .AutoClose}} onload="done()"{{end}}>
+Thanks for authenticating{{with .AppName}} with {{.}}{{end}}{{with .Email}} as {{.}}{{end}}.
+{{if not .AutoClose}}<p>
+You may close this tab and return to the terminal.
+{{end}}</body>
+</html>
+`))
+
+var failure = `<html>
+<head>
+<title>Authentication Failed</title>
+</head>
+<body>
+Authentication failed: %s
+<p>
+Please return to the terminal.
+</body>
+</html>
+`
+
+var alreadyDone = `<html>
+<head>
+<title>Already Authenticated</title>
+</head>
+<body>
+This authorization has already been completed.
+<p>
+You may close this tab and return to the terminal.
+</body>
+</html>
+`
+
+// fragmentBridge is the page served at the redirect URL in fragment mode.
+// It forwards the parameters in the fragment to the path in %s as a query,
+// along with any in the query itself, where a provider may still report
+// an error such as access_denied.
+var fragmentBridge = `<html>
+<head>
+<title>Authenticating</title>
+<script>
+var params = [window.location.search.substring(1), window.location.hash.substring(1)];
+window.location.replace("%s?" + params.filter(function(p) { return p != ""; }).join("&"));
+</script>
 </head>
-<body onload="done()">
-Thanks for authenticating.
+<body>
+Completing authentication...
 </body>
 </html>
 `
@@ -0,0 +1,232 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// testProvider starts a token endpoint that issues tokens for the code "good"
+// and returns a config using it, counting the exchanges in *exchanges.
+func testProvider(t *testing.T, exchanges *int) *oauth.Config {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*exchanges++
+		if req.FormValue("code") != "good" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"token1","token_type":"Bearer","expires_in":3600}`)
+	}))
+	t.Cleanup(srv.Close)
+	return &oauth.Config{
+		ClientID: "client",
+		Endpoint: oauth.Endpoint{
+			AuthURL:   "https://provider.example/auth",
+			TokenURL:  srv.URL + "/token",
+			AuthStyle: oauth.AuthStyleInParams,
+		},
+	}
+}
+
+// testBrowser replaces openURL with a browser that visits the local URL,
+// follows the redirect only as far as reading the provider URL,
+// and then visits the redirect URL with the query returned by callback,
+// given the provider URL's query. It returns a channel receiving
+// each page shown after the callback.
+func testBrowser(t *testing.T, callback func(q url.Values) string) <-chan string {
+	pages := make(chan string, 10)
+	old := openURL
+	t.Cleanup(func() { openURL = old })
+	// Without keep-alives, the transport does not dial spare
+	// connections, which would delay the server's shutdown.
+	client := &http.Client{
+		Transport: &http.Transport{DisableKeepAlives: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	openURL = func(localURL string) error {
+		resp, err := client.Get(localURL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		// Browsers cache permanent redirects, which would replay
+		// an old state when the local URL is reused.
+		if resp.StatusCode != http.StatusFound || resp.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("local URL redirect: status %d, Cache-Control %q; want 302, no-store", resp.StatusCode, resp.Header.Get("Cache-Control"))
+		}
+		u, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		go func() {
+			resp, err := client.Get(q.Get("redirect_uri") + "?" + callback(q))
+			if err != nil {
+				t.Errorf("callback: %v", err)
+				return
+			}
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			pages <- string(data)
+		}()
+		return nil
+	}
+	return pages
+}
+
+func TestTokenBadState(t *testing.T) {
+	var exchanges int
+	cfg := testProvider(t, &exchanges)
+	pages := testBrowser(t, func(q url.Values) string {
+		return "code=good&state=wrong" + q.Get("state")
+	})
+
+	file := filepath.Join(t.TempDir(), "token")
+	_, err := TokenWithOptions(file, cfg, WithLogger(t.Logf))
+	if err == nil || !strings.Contains(err.Error(), "incorrect response") {
+		t.Fatalf("TokenWithOptions with bad state: err = %v, want incorrect response", err)
+	}
+	if !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("TokenWithOptions with bad state: err = %v, want ErrStateMismatch", err)
+	}
+	if exchanges != 0 {
+		t.Errorf("TokenWithOptions with bad state exchanged the code")
+	}
+	if page := <-pages; !strings.Contains(page, "incorrect response") {
+		t.Errorf("page shown for bad state = %q, want incorrect response", page)
+	}
+}
+
+func TestTokenState(t *testing.T) {
+	old := randReader
+	t.Cleanup(func() { randReader = old })
+	randReader = bytes.NewReader(bytes.Repeat([]byte{0xab}, 64))
+
+	var exchanges int
+	cfg := testProvider(t, &exchanges)
+	var state string
+	testBrowser(t, func(q url.Values) string {
+		state = q.Get("state")
+		return "code=good&state=" + url.QueryEscape(state)
+	})
+
+	file := filepath.Join(t.TempDir(), "token")
+	res, err := TokenResult(file, cfg, WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("ab", 16); state != want {
+		t.Errorf("state = %q, want %q", state, want)
+	}
+	if res.Token.AccessToken != "token1" || res.Cached {
+		t.Errorf("TokenResult = %q, cached %v; want token1, not cached", res.Token.AccessToken, res.Cached)
+	}
+
+	// The token is now cached, so the browser is not needed.
+	openURL = func(string) error {
+		t.Errorf("opened browser for cached token")
+		return errors.New("no browser")
+	}
+	res, err = TokenResult(file, cfg, WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Token.AccessToken != "token1" || !res.Cached || exchanges != 1 {
+		t.Errorf("second TokenResult = %q, cached %v, %d exchanges; want token1, cached, 1 exchange", res.Token.AccessToken, res.Cached, exchanges)
+	}
+}
+
+func TestTokenExpired(t *testing.T) {
+	var exchanges int
+	cfg := testProvider(t, &exchanges)
+	testBrowser(t, func(q url.Values) string {
+		return "code=good&state=" + url.QueryEscape(q.Get("state"))
+	})
+
+	file := filepath.Join(t.TempDir(), "token")
+	if _, err := TokenWithOptions(file, cfg, WithLogger(t.Logf)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two hours later, the token, which has no refresh token,
+	// has expired, so the user must be asked again.
+	old := timeNow
+	t.Cleanup(func() { timeNow = old })
+	timeNow = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	res, err := TokenResult(file, cfg, WithLogger(t.Logf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Cached || exchanges != 2 {
+		t.Errorf("TokenResult after expiry: cached %v, %d exchanges; want not cached, 2 exchanges", res.Cached, exchanges)
+	}
+}
+
+func TestTokenReadOnly(t *testing.T) {
+	var exchanges int
+	cfg := testProvider(t, &exchanges)
+	testBrowser(t, func(q url.Values) string {
+		return "code=good&state=" + url.QueryEscape(q.Get("state"))
+	})
+
+	// The warning is logged even without WithVerbose.
+	var logs []string
+	logf := func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	file := filepath.Join(t.TempDir(), "token")
+	if _, err := TokenWithOptions(file, cfg, WithReadOnly(true), WithLogger(logf)); err != nil {
+		t.Fatal(err)
+	}
+	if log := strings.Join(logs, "\n"); !strings.Contains(log, "not saved") {
+		t.Errorf("read-only cache did not warn that the token was not saved:\n%s", log)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("read-only cache wrote %s: %v", file, err)
+	}
+}
+
+func TestTokenFilePerm(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skipf("no Unix file modes on %s", runtime.GOOS)
+	}
+	var exchanges int
+	cfg := testProvider(t, &exchanges)
+	testBrowser(t, func(q url.Values) string {
+		return "code=good&state=" + url.QueryEscape(q.Get("state"))
+	})
+
+	for _, perm := range []os.FileMode{0, 0640} {
+		file := filepath.Join(t.TempDir(), "token")
+		if _, err := TokenWithOptions(file, cfg, WithTokenFilePerm(perm), WithLogger(t.Logf)); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := orDefault(perm, 0600)
+		if got := fi.Mode().Perm(); got != want {
+			t.Errorf("WithTokenFilePerm(%#o): file mode = %#o, want %#o", perm, got, want)
+		}
+	}
+}
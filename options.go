@@ -0,0 +1,654 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// An Option configures the behavior of TokenWithOptions.
+type Option func(*options)
+
+// options holds the settings that control the behavior of token.
+type options struct {
+	ctx                context.Context                  // context for the exchange and the returned client
+	timeout            time.Duration                    // how long to wait for the callback; 0 means forever
+	successHTML        string                           // page shown after authorization; "" means the template
+	successTemplate    *template.Template               // template for the page shown after authorization; nil means the default
+	appName            string                           // name of the application, for the success page
+	successRedirectURL string                           // if set, redirect here after authorization instead
+	autoClose          time.Duration                    // delay before the default success page closes itself; 0 means never
+	errorHTML          string                           // page shown when authorization fails; "" means the default
+	openURL            func(url string) error           // opens a URL in the user's browser
+	manualCode         bool                             // ask the user to paste the code instead of using a local server
+	pkce               bool                             // use a PKCE code challenge
+	listenAddr         string                           // address for the local server; "" means an ephemeral localhost port
+	listener           net.Listener                     // listener for the local server, supplied by the caller
+	keepListener       bool                             // do not close listener when done
+	redirectHost       string                           // host in the redirect URL; "" means the listener's address
+	ports              []int                            // loopback ports to try in order for the local server
+	network            string                           // network for the local server: "tcp4", "tcp6", or "tcp"; "" means "tcp"
+	logf               func(format string, args ...any) // logs progress messages
+	forceReauth        bool                             // ignore any cached token
+	cacheDisabled      bool                             // keep tokens in memory instead of in the cache file
+	xdg                bool                             // resolve relative cache files against $XDG_CACHE_HOME
+	stateLength        int                              // random bytes in the state parameter
+	state              func() (string, error)           // generates the state parameter; nil means random
+	stateVerify        func(state string) error         // checks the state in the callback; nil means compare
+	httpClient         *http.Client                     // client for requests to the provider; nil means the default
+	authCodeOptions    []oauth.AuthCodeOption           // extra parameters for the authorization URL
+	exchangeOptions    []oauth.AuthCodeOption           // extra parameters for the token request
+	redirectInfo       func(url string)                 // called with the redirect URL in use
+	redirectPath       string                           // path of the callback on the local server
+	envToken           string                           // environment variable holding a token to use
+	device             bool                             // use the device authorization flow
+	code               string                           // authorization code to exchange instead of asking the user
+	qrCode             bool                             // show the authorization URL as a QR code
+	minValidity        time.Duration                    // refresh cached tokens expiring sooner than this
+	maxAge             time.Duration                    // ask the user again after this long; 0 means never
+	tokenNotify        func(*oauth.Token)               // called with each new token
+	fragment           bool                             // the provider returns the parameters in the URL fragment
+	noBrowser          bool                             // do not open the browser; the caller presents the URL
+	onAuthURL          func(url string)                 // called before the user is sent to the authorization URL
+	onSuccess          func(*oauth.Token)               // called after the user has authorized access
+	verbose            bool                             // log details of the authorization for debugging
+	codec              *codec                           // encoding of the cache file; nil means the default
+	filePerm           os.FileMode                      // permissions of the cache file; 0 means 0600
+	dirPerm            os.FileMode                      // permissions of created directories; 0 means 0700
+	authStyle          oauth.AuthStyle                  // how to send client credentials; 0 means cfg's setting
+	exchangeRetries    int                              // times to retry a failed exchange
+	hostedDomain       string                           // domain the account must belong to; "" means any
+	emailDomain        bool                             // accept a verified email address in hostedDomain without hd
+	readOnly           bool                             // never write to the cache
+	userInfoURL        string                           // endpoint returning the user's profile; "" means none
+	tlsCert, tlsKey    []byte                           // PEM-encoded certificate and key for serving the callback over HTTPS
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		ctx:          context.Background(),
+		openURL:      openURL,
+		logf:         stderrLogf,
+		xdg:          true,
+		stateLength:  16,
+		redirectPath: "/done",
+		autoClose:    5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.ctx = o.withClient(o.ctx)
+	return o
+}
+
+// withClient returns ctx, arranging for requests made by golang.org/x/oauth2
+// to use o.httpClient if set.
+func (o *options) withClient(ctx context.Context) context.Context {
+	if o.httpClient == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth.HTTPClient, o.httpClient)
+}
+
+// notify reports a newly obtained token to the tokenNotify hook, if any.
+func (o *options) notify(tok *oauth.Token) {
+	if o.tokenNotify != nil {
+		o.tokenNotify(tok)
+	}
+}
+
+// success reports a token obtained by asking the user
+// to the onSuccess hook, if any.
+func (o *options) success(tok *oauth.Token) {
+	if o.onSuccess != nil {
+		o.onSuccess(tok)
+	}
+}
+
+// config returns cfg, or a copy adjusted as requested by o.
+func (o *options) config(cfg *oauth.Config) *oauth.Config {
+	if o.authStyle == oauth.AuthStyleAutoDetect {
+		return cfg
+	}
+	cfg1 := *cfg
+	cfg1.Endpoint.AuthStyle = o.authStyle
+	return &cfg1
+}
+
+// fileCache returns the cache stored in file, as configured by o.
+func (o *options) fileCache(file string) *fileCache {
+	return &fileCache{file: file, codec: o.codec, perm: o.filePerm, dirPerm: o.dirPerm}
+}
+
+// stderrLogf is the default logger, which prints to standard error.
+func stderrLogf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// newState returns the state parameter for a new authorization.
+func (o *options) newState() (string, error) {
+	if o.state == nil {
+		return randomID(o.stateLength)
+	}
+	state, err := o.state()
+	if err != nil {
+		return "", fmt.Errorf("oauthprompt.Token: generating state: %v", err)
+	}
+	return state, nil
+}
+
+// checkState reports an error wrapping ErrStateMismatch
+// if got, the state in a callback, is not acceptable
+// for an authorization that sent want.
+func (o *options) checkState(got, want string) error {
+	if o.stateVerify != nil {
+		if err := o.stateVerify(got); err != nil {
+			return fmt.Errorf("oauthprompt.Token: %w: %v", ErrStateMismatch, err)
+		}
+		return nil
+	}
+	if got != want {
+		return fmt.Errorf("oauthprompt.Token: %w", ErrStateMismatch)
+	}
+	return nil
+}
+
+// codeOptions returns the options to pass to AuthCodeURL and
+// to the corresponding Exchange.
+func (o *options) codeOptions() (auth, exchange []oauth.AuthCodeOption, err error) {
+	auth = append(auth, o.authCodeOptions...)
+	exchange = append(exchange, o.exchangeOptions...)
+	if o.hostedDomain != "" {
+		auth = append(auth, oauth.SetAuthURLParam("hd", o.hostedDomain))
+	}
+	if o.pkce {
+		v, err := newVerifier()
+		if err != nil {
+			return nil, nil, err
+		}
+		auth = append(auth, oauth.S256ChallengeOption(v))
+		exchange = append(exchange, oauth.VerifierOption(v))
+	}
+	return auth, exchange, nil
+}
+
+// TokenWithOptions is like Token but its behavior can be adjusted by opts.
+func TokenWithOptions(file string, cfg *oauth.Config, opts ...Option) (*http.Client, error) {
+	o := newOptions(opts)
+	_, ts, err := token(file, cfg, o)
+	if err != nil {
+		return nil, err
+	}
+	return oauth.NewClient(o.ctx, ts), nil
+}
+
+// WithContext sets the context used for the token exchange and the returned
+// client. If ctx is canceled while waiting for the user to complete the
+// authorization in the browser, the flow is abandoned and ctx.Err() returned.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) { o.ctx = ctx }
+}
+
+// WithTimeout sets how long to wait for the user to complete
+// the authorization in the browser before giving up.
+// The timeout applies separately to each authorization, starting when
+// the browser is opened, and the local HTTP server is fully shut down
+// before returning, so a caller may simply try again.
+// The default is to wait forever.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.timeout = timeout }
+}
+
+// WithBrowser sets the function used to open a URL in the user's browser.
+// The default tries $BROWSER and then a list of well-known launchers,
+// falling back to asking the user to visit the URL.
+func WithBrowser(open func(url string) error) Option {
+	return func(o *options) { o.openURL = open }
+}
+
+// WithOpenCommand sets the command, such as
+// []string{"firefox", "--private-window"}, used to open a URL in the user's
+// browser. Each %s in the arguments is replaced by the URL; if there is none,
+// the URL is appended. If the command fails, the usual browsers are tried.
+func WithOpenCommand(cmd []string) Option {
+	cmd = slices.Clone(cmd)
+	return func(o *options) {
+		next := o.openURL
+		o.openURL = func(url string) error {
+			if len(cmd) > 0 {
+				args := withURL(cmd, url)
+				if err := launch(args); err == nil {
+					return nil
+				}
+			}
+			return next(url)
+		}
+	}
+}
+
+// WithSuccessHTML sets the HTML page shown in the browser
+// once the user has completed the authorization.
+func WithSuccessHTML(html string) Option {
+	return func(o *options) { o.successHTML = html }
+}
+
+// WithSuccessAutoClose sets how long the default success page waits
+// before trying to close its browser tab. Many browsers refuse to close
+// tabs not opened by a script, so a zero or negative d disables the attempt,
+// and the page instead tells the user to close the tab.
+// The default is 5 seconds.
+func WithSuccessAutoClose(d time.Duration) Option {
+	return func(o *options) { o.autoClose = d }
+}
+
+// WithErrorHTML sets the HTML page shown in the browser when the
+// authorization fails, such as when the user denies access.
+// Each %s in the page is replaced by the HTML-escaped error message.
+// The default page shows the error and asks the user to return to the terminal.
+func WithErrorHTML(html string) Option {
+	return func(o *options) { o.errorHTML = html }
+}
+
+// WithSuccessTemplate sets the template used to render the HTML page shown
+// in the browser once the user has completed the authorization, instead of
+// the default page. The template is executed with a *SuccessData, so that the
+// page can show, for example, which account was authorized. WithSuccessHTML,
+// if also set, takes precedence.
+func WithSuccessTemplate(tmpl *template.Template) Option {
+	return func(o *options) { o.successTemplate = tmpl }
+}
+
+// WithAppName sets the application name shown on the success page,
+// available to templates as SuccessData.AppName.
+func WithAppName(name string) Option {
+	return func(o *options) { o.appName = name }
+}
+
+// WithSuccessRedirectURL arranges for the browser to be redirected to url
+// once the user has completed the authorization, instead of showing a page.
+func WithSuccessRedirectURL(url string) Option {
+	return func(o *options) { o.successRedirectURL = url }
+}
+
+// WithManualCode sets whether to ask the user to paste the authorization
+// code into the terminal instead of receiving it through a local HTTP server.
+// This is useful when the browser cannot reach the local machine,
+// such as in an SSH session without port forwarding.
+// The provider must support the out-of-band redirect URL
+// "urn:ietf:wg:oauth:2.0:oob".
+func WithManualCode(manual bool) Option {
+	return func(o *options) { o.manualCode = manual }
+}
+
+// WithDeviceFlow sets whether to use the OAuth 2.0 device authorization
+// flow, as DeviceToken does, instead of a browser and local HTTP server.
+func WithDeviceFlow(device bool) Option {
+	return func(o *options) { o.device = device }
+}
+
+// WithPKCE sets whether to use Proof Key for Code Exchange (RFC 7636)
+// during the authorization. PKCE protects the authorization code from
+// interception and allows public clients to omit the client secret.
+func WithPKCE(pkce bool) Option {
+	return func(o *options) { o.pkce = pkce }
+}
+
+// WithListenAddr sets the address, such as "127.0.0.1:8723", on which the
+// local HTTP server listens for the callback. This is needed for providers
+// that only accept redirect URLs with a fixed, pre-registered port.
+// The default is an ephemeral port on the loopback interface.
+func WithListenAddr(addr string) Option {
+	return func(o *options) { o.listenAddr = addr }
+}
+
+// WithTLS arranges for the local HTTP server to serve the callback over
+// HTTPS using the given PEM-encoded certificate and private key,
+// for providers that accept only https redirect URLs, even on localhost.
+// Unless the certificate is trusted by the user's browser for the
+// loopback address, the user must accept a warning about it
+// before the browser will complete the redirect.
+func WithTLS(certPEM, keyPEM []byte) Option {
+	return func(o *options) { o.tlsCert, o.tlsKey = certPEM, keyPEM }
+}
+
+// WithListener sets the listener on which the local HTTP server accepts
+// the callback, such as one already bound by a supervisor or an in-memory
+// listener in a test, instead of listening on a new one. The redirect URL
+// is derived from l.Addr(), unless WithRedirectHost is set, as it must be
+// for listeners that are not TCP listeners. The listener is closed when
+// the authorization ends, so it can be used for only one authorization,
+// unless WithKeepListener is set.
+// WithListener takes precedence over WithListenAddr and WithPorts.
+func WithListener(l net.Listener) Option {
+	return func(o *options) { o.listener = l }
+}
+
+// WithKeepListener sets whether to leave the listener set by WithListener
+// open when the authorization ends, so that the caller can use it again.
+// The listener must have a SetDeadline method, as *net.TCPListener and
+// *net.UnixListener do, which is used to stop accepting connections.
+func WithKeepListener(keep bool) Option {
+	return func(o *options) { o.keepListener = keep }
+}
+
+// WithRedirectHost sets the host, such as "localhost:8080", used in the
+// redirect URL sent to the provider and in the URL opened in the browser,
+// instead of the address of the local HTTP server's listener. It is required
+// when the listener set by WithListener is not a TCP listener, such as a
+// Unix domain socket reached through a proxy listening at host.
+func WithRedirectHost(host string) Option {
+	return func(o *options) { o.redirectHost = host }
+}
+
+// WithPorts sets the ports on the loopback interface to try, in order,
+// for the local HTTP server, which uses the first one that is free.
+// This suits providers that require a pre-registered redirect URL
+// but allow several to be registered. WithListenAddr takes precedence.
+// The default is an ephemeral port.
+func WithPorts(ports []int) Option {
+	ports = slices.Clone(ports)
+	return func(o *options) { o.ports = ports }
+}
+
+// WithNetwork sets the network, "tcp4", "tcp6", or "tcp", on which the
+// local HTTP server listens for the callback. With "tcp4" or "tcp6",
+// the server listens only on the IPv4 loopback address 127.0.0.1 or
+// the IPv6 loopback address [::1], respectively, and fails if that is
+// not possible, so that the redirect URL always uses that address.
+// The default, "tcp", prefers IPv4 and falls back to IPv6.
+func WithNetwork(network string) Option {
+	return func(o *options) { o.network = network }
+}
+
+// WithLogger sets the function used to log progress messages, such as
+// the local URL being opened in the browser. Messages do not end in a newline,
+// so log.Printf is a suitable logger. A nil logf discards the messages.
+// The default prints them to standard error.
+func WithLogger(logf func(format string, args ...any)) Option {
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	return func(o *options) { o.logf = logf }
+}
+
+// WithForceReauth sets whether to ignore any cached token and always ask
+// the user to authorize access again, overwriting the cache file.
+func WithForceReauth(force bool) Option {
+	return func(o *options) { o.forceReauth = force }
+}
+
+// WithCacheDisabled sets whether to keep tokens in memory for the life of
+// the process instead of in the cache file, which is neither read nor written.
+// The user is asked to authorize access the first time a token is needed,
+// and later calls in the same process using the same client and provider
+// reuse that token, even from other goroutines.
+func WithCacheDisabled(disabled bool) Option {
+	return func(o *options) { o.cacheDisabled = disabled }
+}
+
+// WithXDGCache sets whether a relative cache file name is resolved against
+// $XDG_CACHE_HOME when that variable is set. The default is true.
+// Passing false restores the older behavior of always resolving
+// relative names against the user's home directory.
+func WithXDGCache(xdg bool) Option {
+	return func(o *options) { o.xdg = xdg }
+}
+
+// WithCodec sets the functions used to encode the token in the cache file
+// and to decode it again, for example to encrypt the file or to match the
+// layout expected by other tools. Such files record only the token, so
+// unlike the default JSON encoding, the token is reused even if it was
+// obtained for a different client or set of scopes.
+func WithCodec(marshal func(*oauth.Token) ([]byte, error), unmarshal func([]byte) (*oauth.Token, error)) Option {
+	return func(o *options) { o.codec = &codec{marshal, unmarshal} }
+}
+
+// WithTokenFilePerm sets the permissions of the cache file.
+// The default, 0600, makes it readable only by its owner, since anyone
+// who can read the file can act as the user. Broader permissions,
+// such as 0640, allow sharing a service account's token with a group.
+func WithTokenFilePerm(perm os.FileMode) Option {
+	return func(o *options) { o.filePerm = perm }
+}
+
+// WithDirPerm sets the permissions of any directories created
+// to hold the cache file. The default is 0700.
+func WithDirPerm(perm os.FileMode) Option {
+	return func(o *options) { o.dirPerm = perm }
+}
+
+// WithStateLength sets the number of random bytes in the state parameter
+// that protects the callback against cross-site request forgery.
+// A new state is generated for each authorization, so callbacks
+// from earlier attempts are rejected. The default is 16 bytes.
+// Values less than 16 are ignored.
+func WithStateLength(n int) Option {
+	return func(o *options) {
+		if n >= 16 {
+			o.stateLength = n
+		}
+	}
+}
+
+// WithState sets a function to generate the state parameter sent to the
+// provider, such as a signed value binding the authorization to the caller's
+// session. WithStateLength has no effect when this is set. The default is
+// a new random value for each authorization.
+func WithState(f func() (string, error)) Option {
+	return func(o *options) { o.state = f }
+}
+
+// WithStateVerify sets a function to check the state parameter in the
+// callback, instead of requiring it to equal the one sent to the provider.
+// If f returns an error, the authorization fails with an error wrapping
+// ErrStateMismatch. The callback's state is not available when
+// using WithManualCode, so f is not called in that case.
+func WithStateVerify(f func(state string) error) Option {
+	return func(o *options) { o.stateVerify = f }
+}
+
+// WithHTTPClient sets the HTTP client used for requests to the provider,
+// such as the token exchange and refreshes, and as the base of the
+// returned client. This allows configuring proxies, custom certificate
+// authorities, or timeouts. The default is http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) { o.httpClient = client }
+}
+
+// WithAuthCodeOptions adds parameters to the authorization URL, such as
+// oauth2.SetAuthURLParam("login_hint", email) or oauth2.AccessTypeOffline,
+// for providers that need them. It may be given more than once.
+func WithAuthCodeOptions(opts ...oauth.AuthCodeOption) Option {
+	return func(o *options) { o.authCodeOptions = append(o.authCodeOptions, opts...) }
+}
+
+// WithExchangeOptions adds parameters to the token request exchanging the
+// authorization code, such as oauth2.SetAuthURLParam("audience", api)
+// for Auth0 or oauth2.SetAuthURLParam("resource", uri) for Azure,
+// for providers that need them. It may be given more than once.
+func WithExchangeOptions(opts ...oauth.AuthCodeOption) Option {
+	return func(o *options) { o.exchangeOptions = append(o.exchangeOptions, opts...) }
+}
+
+// WithRedirectInfo sets a function to be called with the redirect URL
+// sent to the provider, such as "http://127.0.0.1:51234/done",
+// once it is known and before the browser is opened.
+// The URL shows whether the IPv4 or IPv6 loopback address is in use,
+// which can help diagnose providers rejecting the redirect URL.
+func WithRedirectInfo(f func(url string)) Option {
+	return func(o *options) { o.redirectInfo = f }
+}
+
+// WithRedirectPath sets the path, such as "/oauth/callback", at which the
+// local HTTP server receives the callback, for providers that require
+// the redirect URL to match a registered one exactly. The default is "/done".
+func WithRedirectPath(path string) Option {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return func(o *options) { o.redirectPath = path }
+}
+
+// WithFragmentMode sets whether the provider returns the authorization code
+// in the fragment of the redirect URL, as in "/done#code=...&state=...",
+// instead of in the query. Browsers do not send the fragment to the server,
+// so the local HTTP server instead responds with a small script that
+// forwards the fragment's parameters to it. Asking the provider to do this,
+// such as with the response_mode=fragment parameter, is up to the caller.
+func WithFragmentMode(fragment bool) Option {
+	return func(o *options) { o.fragment = fragment }
+}
+
+// WithEnvToken sets the name of an environment variable that, when set,
+// supplies the token to use instead of the cache or the browser.
+// The variable may hold a JSON-encoded oauth.Token or a bare access token.
+// This allows the same program to run unattended, as in continuous integration,
+// with a token obtained elsewhere. Such tokens are never written to the cache.
+func WithEnvToken(name string) Option {
+	return func(o *options) { o.envToken = name }
+}
+
+// WithQRCode sets whether to print the authorization URL to the terminal
+// as a QR code, in addition to the usual message, so that the user can
+// scan it with a phone. Completing the authorization on another device
+// works only if the redirect can reach this program, so this is most
+// useful with WithManualCode.
+func WithQRCode(qr bool) Option {
+	return func(o *options) { o.qrCode = qr }
+}
+
+// WithMinValidity sets the minimum remaining lifetime of the token returned.
+// If the cached token expires within d, it is refreshed before returning,
+// and the new token is written to the cache. If it cannot be refreshed,
+// the user is asked to authorize access again. This avoids requests failing
+// because the token expired just after the program started.
+func WithMinValidity(d time.Duration) Option {
+	return func(o *options) { o.minValidity = d }
+}
+
+// WithMaxAge sets how long a cached token may be used, however often it is
+// refreshed, before the user is asked to authorize access again, as some
+// security policies require. The age is measured from when the user last
+// authorized access, which is recorded in the cache file; refreshing the
+// token does not reset it. Tokens kept in a Store or encoded using
+// WithCodec do not record their age, so this does not apply to them.
+// The default is no limit.
+func WithMaxAge(d time.Duration) Option {
+	return func(o *options) { o.maxAge = d }
+}
+
+// WithTokenNotify sets a function to be called with each new token,
+// whether obtained by asking the user or by refreshing, after it has been
+// written to the cache. Providers that rotate refresh tokens invalidate
+// the old one on every refresh, so this allows mirroring the current token
+// to another secret store or recording it in an audit log.
+func WithTokenNotify(f func(tok *oauth.Token)) Option {
+	return func(o *options) { o.tokenNotify = f }
+}
+
+// WithVerbose sets whether to log details of the authorization, such as
+// the authorization and redirect URLs and, if the token exchange fails,
+// the response from the provider, to help diagnose a misconfigured client.
+// Codes, tokens, secrets, and state values are redacted from these logs.
+// Messages are logged using the function set by WithLogger.
+func WithVerbose(verbose bool) Option {
+	return func(o *options) { o.verbose = verbose }
+}
+
+// WithAuthStyle sets how the client ID and secret are sent to the provider's
+// token endpoint, overriding cfg.Endpoint.AuthStyle. Forcing
+// oauth2.AuthStyleInHeader or oauth2.AuthStyleInParams avoids the extra
+// request made to detect the style, which some strict providers reject.
+// Passing oauth2.AuthStyleAutoDetect leaves cfg's setting in effect.
+func WithAuthStyle(style oauth.AuthStyle) Option {
+	return func(o *options) { o.authStyle = style }
+}
+
+// WithExchangeRetries sets how many times to retry exchanging the
+// authorization code for a token when the exchange fails with a network
+// error or a 429 or 5xx response, waiting 1s, 2s, 4s, and so on between
+// attempts. Other failures, such as an invalid_grant error, are not retried.
+// Since the code may be used only once, a failed exchange otherwise
+// requires the user to authorize access again. The default is 0.
+func WithExchangeRetries(n int) Option {
+	return func(o *options) { o.exchangeRetries = n }
+}
+
+// WithOnAuthURL sets a function to be called with the provider's
+// authorization URL just before the user is sent there, by opening
+// the browser or, with WithManualCode, printing the URL.
+// This lets a program wrapping the flow, such as a GUI, show its progress
+// without parsing the messages printed for the user.
+func WithOnAuthURL(f func(url string)) Option {
+	return func(o *options) { o.onAuthURL = f }
+}
+
+// WithBrowserDisabled sets whether to skip opening the user's browser,
+// while still running the local HTTP server and waiting for the callback.
+// Combined with WithOnAuthURL, this lets a desktop application show the
+// authorization URL in its own embedded window instead.
+func WithBrowserDisabled(disabled bool) Option {
+	return func(o *options) { o.noBrowser = disabled }
+}
+
+// WithOnSuccess sets a function to be called with the token
+// once the user has authorized access and the token has been obtained,
+// before it is written to the cache.
+func WithOnSuccess(f func(tok *oauth.Token)) Option {
+	return func(o *options) { o.onSuccess = f }
+}
+
+// WithHostedDomain restricts authorization to accounts in domain,
+// such as a Google Workspace domain. It asks the provider to offer only
+// accounts in the domain, using the hd parameter, and then checks that
+// the hd claim of the ID token returned with the token matches.
+// Otherwise the token is discarded, not cached, and an error returned.
+// Cached tokens for other accounts are likewise ignored.
+// The configuration must request the openid or email scope,
+// so that the provider returns an ID token.
+// For providers that do not set hd, see WithEmailDomain.
+func WithHostedDomain(domain string) Option {
+	return func(o *options) { o.hostedDomain = domain }
+}
+
+// WithEmailDomain sets whether WithHostedDomain accepts an ID token
+// without an hd claim if its email address is in the domain and the
+// provider reports the address as verified. Use it only for providers
+// that verify addresses before reporting them as verified. It never
+// applies to Google, where an account outside Workspace can use any
+// address, including one in the domain. The default is false.
+func WithEmailDomain(allow bool) Option {
+	return func(o *options) { o.emailDomain = allow }
+}
+
+// WithReadOnly sets whether to use the cache file only for reading.
+// A cached token is still used if valid, but a new or refreshed token is
+// kept in memory, for the returned client, instead of being written back.
+// This suits read-only file systems, such as immutable container images,
+// where writing the cache would fail after a successful authorization.
+func WithReadOnly(readOnly bool) Option {
+	return func(o *options) { o.readOnly = readOnly }
+}
+
+// WithUserInfoURL sets the URL of the provider's user info endpoint,
+// such as https://openidconnect.googleapis.com/v1/userinfo, to be fetched
+// with the new token once the user has authorized access. The decoded
+// response is cached with the token and returned as Result.UserInfo,
+// along with the user's email address as Result.Email, so that callers
+// can identify the user without another request. A failure to fetch
+// the user info is logged but does not prevent returning the token.
+func WithUserInfoURL(url string) Option {
+	return func(o *options) { o.userInfoURL = url }
+}
@@ -0,0 +1,251 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// A provider describes an OAuth provider known by name.
+type provider struct {
+	endpoint  oauth.Endpoint
+	scopes    []string               // scopes to request in addition to the caller's
+	authOpts  []oauth.AuthCodeOption // extra parameters for the authorization URL
+	revokeURL string                 // token revocation endpoint (RFC 7009), if any
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]*provider{
+		"google": {
+			endpoint: oauth.Endpoint{
+				AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+				TokenURL: "https://accounts.google.com/o/oauth2/token",
+			},
+			// Request offline access, so that Google issues a refresh token.
+			authOpts:  []oauth.AuthCodeOption{oauth.AccessTypeOffline, oauth.ApprovalForce},
+			revokeURL: "https://oauth2.googleapis.com/revoke",
+		},
+		"github": {
+			endpoint: oauth.Endpoint{
+				AuthURL:   "https://github.com/login/oauth/authorize",
+				TokenURL:  "https://github.com/login/oauth/access_token",
+				AuthStyle: oauth.AuthStyleInParams,
+			},
+		},
+		"gitlab":    gitlabProvider(""),
+		"microsoft": microsoftProvider(""),
+	}
+)
+
+// RegisterProvider makes the OAuth provider with the given endpoint
+// available to ProviderToken under name, replacing any existing provider
+// with that name. The built-in providers are "google", "github", "gitlab",
+// and "microsoft".
+func RegisterProvider(name string, ep oauth.Endpoint) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = &provider{endpoint: ep}
+}
+
+// RegisterRevokeURL records the token revocation endpoint (RFC 7009)
+// of the named provider, for use by LogoutWithRevoke.
+// The provider must already be registered.
+func RegisterRevokeURL(name, revokeURL string) error {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	p := providers[name]
+	if p == nil {
+		return fmt.Errorf("oauthprompt: unknown provider %q", name)
+	}
+	p.revokeURL = revokeURL
+	return nil
+}
+
+// revokeURL returns the revocation endpoint of the registered provider
+// with the same authorization URL as ep, or "" if there is none.
+func revokeURL(ep oauth.Endpoint) string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	for _, p := range providers {
+		if p.endpoint.AuthURL == ep.AuthURL {
+			return p.revokeURL
+		}
+	}
+	return ""
+}
+
+// ProviderToken is like Token but assumes the AuthURL and TokenURL of the
+// named provider, so that only the client ID and secret and desired scope
+// must be specified. Providers are registered with RegisterProvider.
+func ProviderToken(name, file, clientID, clientSecret string, scopes ...string) (*http.Client, error) {
+	return ProviderTokenContext(context.Background(), name, file, clientID, clientSecret, scopes...)
+}
+
+// ProviderTokenContext is like ProviderToken but uses ctx
+// as described for TokenContext.
+func ProviderTokenContext(ctx context.Context, name, file, clientID, clientSecret string, scopes ...string) (*http.Client, error) {
+	providersMu.RLock()
+	p := providers[name]
+	providersMu.RUnlock()
+	if p == nil {
+		return nil, fmt.Errorf("oauthprompt: unknown provider %q", name)
+	}
+	return p.token(ctx, file, clientID, clientSecret, scopes)
+}
+
+// token obtains a token from p, as described by ProviderTokenContext.
+func (p *provider) token(ctx context.Context, file, clientID, clientSecret string, scopes []string) (*http.Client, error) {
+	return TokenWithOptions(file, p.config(clientID, clientSecret, scopes), WithContext(ctx), WithAuthCodeOptions(p.authOpts...))
+}
+
+// config returns the configuration for a client of p.
+func (p *provider) config(clientID, clientSecret string, scopes []string) *oauth.Config {
+	scopes = slices.Clip(scopes)
+	for _, scope := range p.scopes {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return &oauth.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		Endpoint:     p.endpoint,
+	}
+}
+
+// ProviderConfig returns the configuration used by ProviderToken,
+// for callers that obtain or use tokens some other way.
+// It returns nil if there is no provider with the given name.
+func ProviderConfig(name, clientID, clientSecret string, scopes ...string) *oauth.Config {
+	providersMu.RLock()
+	p := providers[name]
+	providersMu.RUnlock()
+	if p == nil {
+		return nil
+	}
+	return p.config(clientID, clientSecret, scopes)
+}
+
+// GoogleToken is like Token but assumes the Google AuthURL and TokenURL,
+// so that only the client ID and secret and desired scope must be specified.
+// It requests offline access, so that Google issues a refresh token
+// and the cached token remains usable after the access token expires.
+func GoogleToken(file, clientID, clientSecret string, scopes ...string) (*http.Client, error) {
+	return GoogleTokenContext(context.Background(), file, clientID, clientSecret, scopes...)
+}
+
+// GoogleConfig returns the configuration used by GoogleToken.
+// Note that GoogleToken also requests offline access,
+// which is a parameter of the authorization URL, not part of the configuration.
+func GoogleConfig(clientID, clientSecret string, scopes ...string) *oauth.Config {
+	return ProviderConfig("google", clientID, clientSecret, scopes...)
+}
+
+// GoogleTokenContext is like GoogleToken but uses ctx
+// as described for TokenContext.
+func GoogleTokenContext(ctx context.Context, file, clientID, clientSecret string, scopes ...string) (*http.Client, error) {
+	return ProviderTokenContext(ctx, "google", file, clientID, clientSecret, scopes...)
+}
+
+// GitHubToken is like Token but assumes the GitHub AuthURL and TokenURL,
+// so that only the client ID and secret and desired scope must be specified.
+// For example, to obtain a client with access to the user's repositories:
+//
+//	client, err := oauthprompt.GitHubToken(".github-token", clientID, clientSecret, "repo")
+func GitHubToken(file, clientID, clientSecret string, scopes ...string) (*http.Client, error) {
+	return GitHubTokenContext(context.Background(), file, clientID, clientSecret, scopes...)
+}
+
+// GitHubConfig returns the configuration used by GitHubToken.
+func GitHubConfig(clientID, clientSecret string, scopes ...string) *oauth.Config {
+	return ProviderConfig("github", clientID, clientSecret, scopes...)
+}
+
+// GitHubTokenContext is like GitHubToken but uses ctx
+// as described for TokenContext.
+func GitHubTokenContext(ctx context.Context, file, clientID, clientSecret string, scopes ...string) (*http.Client, error) {
+	return ProviderTokenContext(ctx, "github", file, clientID, clientSecret, scopes...)
+}
+
+// GitLabToken is like Token but assumes the AuthURL and TokenURL of the
+// GitLab instance at baseURL, such as "https://gitlab.example.com",
+// so that only the client ID and secret and desired scope must be specified.
+// An empty baseURL means "https://gitlab.com".
+func GitLabToken(file, baseURL, clientID, clientSecret string, scopes ...string) (*http.Client, error) {
+	return GitLabTokenContext(context.Background(), file, baseURL, clientID, clientSecret, scopes...)
+}
+
+// GitLabConfig returns the configuration used by GitLabToken.
+func GitLabConfig(baseURL, clientID, clientSecret string, scopes ...string) *oauth.Config {
+	return gitlabProvider(baseURL).config(clientID, clientSecret, scopes)
+}
+
+// GitLabTokenContext is like GitLabToken but uses ctx
+// as described for TokenContext.
+func GitLabTokenContext(ctx context.Context, file, baseURL, clientID, clientSecret string, scopes ...string) (*http.Client, error) {
+	return gitlabProvider(baseURL).token(ctx, file, clientID, clientSecret, scopes)
+}
+
+// gitlabProvider returns the provider for the GitLab instance at baseURL.
+func gitlabProvider(baseURL string) *provider {
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	base := strings.TrimSuffix(baseURL, "/") + "/oauth/"
+	return &provider{
+		endpoint: oauth.Endpoint{
+			AuthURL:  base + "authorize",
+			TokenURL: base + "token",
+		},
+	}
+}
+
+// MicrosoftToken is like Token but assumes the Microsoft identity platform
+// AuthURL and TokenURL for the given tenant, so that only the client ID and secret,
+// tenant, and desired scope must be specified. An empty tenant means "common",
+// which accepts both personal and work or school accounts.
+// Microsoft issues a refresh token only when the offline_access scope
+// is requested, so MicrosoftToken adds that scope if it is missing.
+func MicrosoftToken(file, clientID, clientSecret, tenant string, scopes ...string) (*http.Client, error) {
+	return MicrosoftTokenContext(context.Background(), file, clientID, clientSecret, tenant, scopes...)
+}
+
+// MicrosoftConfig returns the configuration used by MicrosoftToken,
+// including the offline_access scope.
+func MicrosoftConfig(clientID, clientSecret, tenant string, scopes ...string) *oauth.Config {
+	return microsoftProvider(tenant).config(clientID, clientSecret, scopes)
+}
+
+// MicrosoftTokenContext is like MicrosoftToken but uses ctx
+// as described for TokenContext.
+func MicrosoftTokenContext(ctx context.Context, file, clientID, clientSecret, tenant string, scopes ...string) (*http.Client, error) {
+	return microsoftProvider(tenant).token(ctx, file, clientID, clientSecret, scopes)
+}
+
+// microsoftProvider returns the Microsoft identity platform provider
+// for the given tenant.
+func microsoftProvider(tenant string) *provider {
+	if tenant == "" {
+		tenant = "common"
+	}
+	base := "https://login.microsoftonline.com/" + url.PathEscape(tenant) + "/oauth2/v2.0/"
+	return &provider{
+		endpoint: oauth.Endpoint{
+			AuthURL:  base + "authorize",
+			TokenURL: base + "token",
+		},
+		scopes: []string{"offline_access"},
+	}
+}
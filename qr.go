@@ -0,0 +1,489 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// This file implements a minimal QR code encoder, enough to show a URL
+// on a terminal: byte mode only, error correction level L, versions 1 to 40.
+// The structure follows ISO/IEC 18004.
+
+// showQR prints url to w as a QR code, for scanning with a phone.
+// It prints nothing if url is too long to encode.
+func showQR(w io.Writer, url string) {
+	q, err := qrEncode([]byte(url))
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "To log in on another device, scan this code:\n%s", q)
+}
+
+// qrECCPerBlock and qrBlocks give, for each version at correction level L,
+// the number of error correction codewords in each block
+// and the number of blocks.
+var (
+	qrECCPerBlock = [41]int{-1,
+		7, 10, 15, 20, 26, 18, 20, 24, 30, 18,
+		20, 24, 26, 30, 22, 24, 28, 30, 28, 28,
+		28, 28, 30, 30, 26, 28, 30, 30, 30, 30,
+		30, 30, 30, 30, 30, 30, 30, 30, 30, 30,
+	}
+	qrBlocks = [41]int{-1,
+		1, 1, 1, 1, 1, 2, 2, 2, 2, 4,
+		4, 4, 4, 4, 6, 6, 6, 6, 7, 8,
+		8, 9, 9, 10, 12, 12, 12, 13, 14, 15,
+		16, 17, 18, 19, 19, 20, 21, 22, 24, 25,
+	}
+)
+
+// A qrCode is a QR code symbol under construction.
+type qrCode struct {
+	version  int
+	size     int
+	dark     [][]bool
+	function [][]bool // module is part of a function pattern, not data
+}
+
+// qrEncode returns the QR code encoding data, or an error if data is too long.
+func qrEncode(data []byte) (*qrCode, error) {
+	version := 1
+	for ; version <= 40; version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*qrDataCodewords(version) {
+			break
+		}
+	}
+	if version > 40 {
+		return nil, fmt.Errorf("data too long for QR code")
+	}
+
+	// Byte mode segment, terminator, and padding.
+	var bits qrBits
+	bits.append(0x4, 4)
+	if version < 10 {
+		bits.append(len(data), 8)
+	} else {
+		bits.append(len(data), 16)
+	}
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := 8 * qrDataCodewords(version)
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i, b := range bits {
+		if b {
+			codewords[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+
+	q := &qrCode{version: version, size: 4*version + 17}
+	q.dark = qrGrid(q.size)
+	q.function = qrGrid(q.size)
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.addECC(codewords))
+
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // undo
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+	return q, nil
+}
+
+func qrGrid(size int) [][]bool {
+	g := make([][]bool, size)
+	for i := range g {
+		g[i] = make([]bool, size)
+	}
+	return g
+}
+
+// qrBits is a sequence of bits.
+type qrBits []bool
+
+// append appends the low n bits of v, most significant first.
+func (b *qrBits) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, v>>i&1 != 0)
+	}
+}
+
+// qrRawModules returns the number of modules available for data
+// and error correction in the given version.
+func qrRawModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// qrDataCodewords returns the number of data codewords in the given version.
+func qrDataCodewords(version int) int {
+	return qrRawModules(version)/8 - qrECCPerBlock[version]*qrBlocks[version]
+}
+
+// qrAlignment returns the row and column coordinates
+// of the alignment patterns in the given version.
+func qrAlignment(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*8 + n*3 + 5) / (n*4 - 4) * 2
+	pos := make([]int, n)
+	pos[0] = 6
+	for i, p := n-1, 4*version+10; i >= 1; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+func (q *qrCode) set(x, y int, dark bool) {
+	q.dark[y][x] = dark
+	q.function[y][x] = true
+}
+
+func (q *qrCode) drawFunctionPatterns() {
+	// Timing patterns.
+	for i := range q.size {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns, with separators.
+	for _, c := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if 0 <= x && x < q.size && 0 <= y && y < q.size {
+					d := max(abs(dx), abs(dy))
+					q.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+
+	// Alignment patterns, except where they would overlap the finders.
+	pos := qrAlignment(q.version)
+	last := len(pos) - 1
+	for i := range pos {
+		for j := range pos {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(pos[i]+dx, pos[j]+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas; drawFormat fills them in.
+	q.drawFormat(0)
+
+	// Version information.
+	if q.version >= 7 {
+		rem := q.version
+		for range 12 {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := q.version<<12 | rem
+		for i := range 18 {
+			dark := bits>>i&1 != 0
+			a, b := q.size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+}
+
+// drawFormat draws the format information for level L and the given mask.
+func (q *qrCode) drawFormat(mask int) {
+	data := 1<<3 | mask // level L
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := range 6 {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := range 8 {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// addECC splits data into blocks, appends error correction codewords
+// to each block, and returns the interleaved result.
+func (q *qrCode) addECC(data []byte) []byte {
+	numBlocks := qrBlocks[q.version]
+	eccLen := qrECCPerBlock[q.version]
+	raw := qrRawModules(q.version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	divisor := rsDivisor(eccLen)
+	var blocks [][]byte
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < numShort {
+			block = append(block, 0)
+		}
+		blocks = append(blocks, append(block, ecc...))
+	}
+
+	var out []byte
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			// Skip the padding byte in short blocks.
+			if i != shortLen-eccLen || j >= numShort {
+				out = append(out, block[i])
+			}
+		}
+	}
+	return out
+}
+
+// drawCodewords places the codewords in the zigzag data area.
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range q.size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.dark[y][x] = data[i>>3]>>(7-i&7)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by the given mask pattern.
+// Applying the same mask twice undoes it.
+func (q *qrCode) applyMask(mask int) {
+	for y := range q.size {
+		for x := range q.size {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.dark[y][x] = !q.dark[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to read, as defined by the standard.
+func (q *qrCode) penalty() int {
+	p := 0
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			x, y = y, x
+		}
+		return q.dark[y][x]
+	}
+	for _, transpose := range []bool{false, true} {
+		for y := range q.size {
+			// Runs of five or more modules of the same color.
+			run := 1
+			for x := 1; x < q.size; x++ {
+				if at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				p += run - 2
+			}
+
+			// Patterns resembling the finder patterns.
+			var line strings.Builder
+			for x := range q.size {
+				if at(x, y, transpose) {
+					line.WriteByte('1')
+				} else {
+					line.WriteByte('0')
+				}
+			}
+			s := "0000" + line.String() + "0000"
+			p += 40 * (strings.Count(s, "00001011101") + strings.Count(s, "10111010000"))
+		}
+	}
+
+	// Two-by-two blocks of the same color.
+	dark := 0
+	for y := range q.size {
+		for x := range q.size {
+			if q.dark[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := q.dark[y][x]
+				if c == q.dark[y-1][x] && c == q.dark[y][x-1] && c == q.dark[y-1][x-1] {
+					p += 3
+				}
+			}
+		}
+	}
+
+	// Imbalance of dark and light modules.
+	total := q.size * q.size
+	p += 10 * (abs(dark*20-total*10) / total)
+	return p
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given degree,
+// with coefficients from highest to lowest power, omitting the leading 1.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return result
+}
+
+// rsRemainder returns the Reed-Solomon error correction codewords for data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMul multiplies x and y in GF(2⁸) modulo x⁸ + x⁴ + x³ + x² + 1.
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// String renders the QR code for a terminal, using Unicode half blocks
+// so that each line of text holds two rows of modules.
+// Light modules are drawn as blocks, which shows the code correctly
+// on a terminal with a dark background. A quiet zone surrounds the code.
+func (q *qrCode) String() string {
+	const quiet = 2
+	light := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		if x < 0 || y < 0 || x >= q.size || y >= q.size {
+			return true
+		}
+		return !q.dark[y][x]
+	}
+	var b strings.Builder
+	n := q.size + 2*quiet
+	for y := 0; y < n; y += 2 {
+		for x := range n {
+			top, bottom := light(x, y), y+1 >= n || light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
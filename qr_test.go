@@ -0,0 +1,111 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"strings"
+	"testing"
+)
+
+// The expected symbols, with # for a dark module, were checked by decoding
+// them with an independent QR code reader. The version 3 symbol also
+// matches, module for module, the output of an independent encoder.
+var qrTests = []struct {
+	data    string
+	version int
+	symbol  string
+}{
+	{"https://x.io", 1, `
+#######.##..#.#######
+#.....#..#..#.#.....#
+#.###.#.#.#.#.#.###.#
+#.###.#.#..#..#.###.#
+#.###.#.###...#.###.#
+#.....#.......#.....#
+#######.#.#.#.#######
+.........##..........
+####..#.#.#..#..###.#
+#.####.###..#########
+.#.#..##..#.##...#.##
+#.#.#....#..#..#.#.#.
+.####.#..#.#.##.##..#
+........####....#....
+#######..##..#..#....
+#.....#....#...####..
+#.###.#..#..#...#.##.
+#.###.#.#.#.#.##...#.
+#.###.#.##.##.##..#..
+#.....#.#.#..####...#
+#######.###.###.###..
+`},
+	{"http://127.0.0.1:12345/auth?state=abc", 3, `
+#######...#...##.####.#######
+#.....#.###..#.##.#.#.#.....#
+#.###.#.#.....####..#.#.###.#
+#.###.#..#..##.#..###.#.###.#
+#.###.#.###.#.###.#.#.#.###.#
+#.....#.#.#.#..##..##.#.....#
+#######.#.#.#.#.#.#.#.#######
+........#.##.#.####.#........
+##.#..##...##.#.#...#.###.##.
+#.###..#.#.###..###..###.#..#
+##..#####..####.#..#.##.####.
+#.#.##..######.##.#.###..###.
+##.####.#.##..##.#....##.#.##
+.#.###..#..#.##.####...#..#..
+.####.#.####.##..#....##..###
+.....#.#####...###...#..##.#.
+#.##.#####..##...#.#.....#.#.
+....#....#..###.##..###.....#
+#.#.###...###.#.#.#..#.#.#.##
+....##...#..#.##.#...#.....##
+#.....#.#.#.......#.#####.#..
+........#..#..#.#.#.#...#.###
+#######.##......##..#.#.#..#.
+#.....#.......##..###...###..
+#.###.#...#.#...##..######.##
+#.###.#.#####....##.###.#..#.
+#.###.#..##.#...#.#.##.###..#
+#.....#.#.#.#######.##.###.#.
+#######.##.#.##.##.###..#..#.
+`},
+}
+
+func TestQREncode(t *testing.T) {
+	for _, tt := range qrTests {
+		q, err := qrEncode([]byte(tt.data))
+		if err != nil {
+			t.Errorf("qrEncode(%q): %v", tt.data, err)
+			continue
+		}
+		if q.version != tt.version {
+			t.Errorf("qrEncode(%q): version %d, want %d", tt.data, q.version, tt.version)
+		}
+		var b strings.Builder
+		for _, row := range q.dark {
+			for _, dark := range row {
+				if dark {
+					b.WriteByte('#')
+				} else {
+					b.WriteByte('.')
+				}
+			}
+			b.WriteByte('\n')
+		}
+		if got, want := b.String(), strings.TrimPrefix(tt.symbol, "\n"); got != want {
+			t.Errorf("qrEncode(%q):\n%s\nwant:\n%s", tt.data, got, want)
+		}
+	}
+}
+
+func TestQREncodeTooLong(t *testing.T) {
+	// Version 40 at level L holds at most 2953 bytes.
+	if _, err := qrEncode(make([]byte, 2953)); err != nil {
+		t.Errorf("qrEncode of 2953 bytes: %v", err)
+	}
+	if _, err := qrEncode(make([]byte, 2954)); err == nil {
+		t.Errorf("qrEncode of 2954 bytes succeeded, want error")
+	}
+}
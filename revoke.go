@@ -0,0 +1,73 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// LogoutWithRevoke is like Logout but first asks the provider to revoke
+// the cached token, so that it cannot be used even if a copy of the file
+// survives. The provider is identified by cfg.Endpoint.AuthURL and must be
+// registered with a revocation endpoint, as Google is; see RegisterRevokeURL.
+// For other providers, LogoutWithRevoke only removes the file.
+// If revocation fails, the file is kept so that the call can be retried.
+func LogoutWithRevoke(ctx context.Context, file string, cfg *oauth.Config) error {
+	u := revokeURL(cfg.Endpoint)
+	if u == "" {
+		return Logout(file)
+	}
+	tok, err := CachedToken(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	// Revoking the refresh token also revokes the access tokens
+	// obtained with it.
+	t := tok.RefreshToken
+	if t == "" {
+		t = tok.AccessToken
+	}
+	if err := revoke(ctx, u, t); err != nil {
+		return err
+	}
+	return Logout(file)
+}
+
+// revoke asks the revocation endpoint revokeURL to revoke token.
+func revoke(ctx context.Context, revokeURL, token string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", revokeURL, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return fmt.Errorf("oauthprompt.LogoutWithRevoke: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := http.DefaultClient
+	if c, ok := ctx.Value(oauth.HTTPClient).(*http.Client); ok {
+		client = c
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("oauthprompt.LogoutWithRevoke: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	// An already revoked or expired token is reported as invalid,
+	// which is as good as revoked.
+	if resp.StatusCode/100 != 2 && !strings.Contains(string(body), "invalid_token") {
+		return fmt.Errorf("oauthprompt.LogoutWithRevoke: revoking token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
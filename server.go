@@ -0,0 +1,136 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// A Server is a local HTTP server receiving the callbacks for a sequence
+// of authorizations, for programs that authorize several configurations
+// in turn. Unlike Begin, which starts a server for each authorization,
+// it listens once, so that every authorization uses the same redirect URL,
+// as a provider with pre-registered redirect URLs may require.
+// A Server runs one authorization at a time.
+type Server struct {
+	opts   []Option
+	l      net.Listener
+	srv    *http.Server
+	base   string        // scheme and host of the server's URLs
+	served chan struct{} // closed when the server has stopped
+
+	mu     sync.Mutex
+	cur    *flow // authorization in progress, or nil
+	closed bool
+}
+
+// NewServer starts a local HTTP server to receive callbacks,
+// listening as configured by opts, such as with WithPorts or WithListener.
+// The other options apply to each authorization started by Flow.
+// The caller must call Close to shut down the server.
+func NewServer(opts ...Option) (*Server, error) {
+	l, base, err := listenCallback(newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		opts:   opts,
+		l:      l,
+		base:   base,
+		served: make(chan struct{}),
+	}
+	s.srv = &http.Server{Handler: http.HandlerFunc(s.serve)}
+	go func() {
+		defer close(s.served)
+		s.srv.Serve(l)
+	}()
+	return s, nil
+}
+
+// RedirectURL returns the redirect URL of authorizations using the server
+// with the default WithRedirectPath.
+func (s *Server) RedirectURL() string {
+	return s.base + newOptions(s.opts).redirectPath
+}
+
+// Flow is like Begin but starts an authorization served by s,
+// using the options passed to NewServer followed by opts.
+// Options that configure listening are ignored.
+// Flow returns an error if another authorization using s
+// is still in progress; the caller must call Wait or Cancel
+// on each Flow before starting the next.
+func (s *Server) Flow(cfg *oauth.Config, opts ...Option) (*Flow, error) {
+	o := newOptions(append(s.opts[:len(s.opts):len(s.opts)], opts...))
+	cfg = o.config(cfg)
+	if err := checkConfig(cfg, o); err != nil {
+		return nil, err
+	}
+	f, err := startFlow(cfg, o, s)
+	if err != nil {
+		return nil, err
+	}
+	return &Flow{f}, nil
+}
+
+// Close shuts down the server, canceling the authorization
+// in progress, if any.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	f := s.cur
+	s.cur = nil
+	s.mu.Unlock()
+	if f != nil {
+		f.cancelOnce.Do(func() { close(f.canceled) })
+	}
+	err := s.srv.Close()
+	s.l.Close()
+	<-s.served
+	releaseListener(newOptions(s.opts))
+	return err
+}
+
+// start starts serving a new flow.
+func (s *Server) start(opts *options, cfg *oauth.Config, authURL func(redirectURL string) string) (*flow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, fmt.Errorf("oauthprompt.Server: server closed")
+	}
+	if s.cur != nil {
+		return nil, fmt.Errorf("oauthprompt.Server: another authorization is in progress")
+	}
+	f := newFlow(opts, cfg, s.base, authURL)
+	f.server = s
+	s.cur = f
+	f.started()
+	return f, nil
+}
+
+// release stops serving f, if it is still being served.
+func (s *Server) release(f *flow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur == f {
+		s.cur = nil
+	}
+}
+
+// serve passes a request to the authorization in progress.
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	f := s.cur
+	s.mu.Unlock()
+	if f == nil {
+		http.Error(w, "", 404)
+		return
+	}
+	f.serve(w, req)
+}
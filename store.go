@@ -0,0 +1,115 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// A Store holds a cached token on behalf of TokenStore.
+type Store interface {
+	// Load returns the stored token.
+	// If no token is stored, Load returns an error e
+	// for which errors.Is(e, fs.ErrNotExist) is true.
+	Load() (*oauth.Token, error)
+
+	// Save stores tok, replacing any previously stored token.
+	Save(tok *oauth.Token) error
+}
+
+// TokenStore is like TokenWithOptions but keeps the cached token in s
+// instead of a file. Unlike cache files, arbitrary stores do not record
+// the scopes a token was obtained for, and concurrent callers are not
+// prevented from prompting the user at the same time.
+func TokenStore(s Store, cfg *oauth.Config, opts ...Option) (*http.Client, error) {
+	o := newOptions(opts)
+	_, ts, err := cachedToken(storeCache(s), cfg, o)
+	if err != nil {
+		return nil, err
+	}
+	return oauth.NewClient(o.ctx, ts), nil
+}
+
+// FileStore returns a Store that keeps the token in file,
+// in the same format as Token. The file name is interpreted as in Token.
+func FileStore(file string) Store {
+	return &fileStore{file}
+}
+
+type fileStore struct {
+	file string
+}
+
+func (s *fileStore) cache() (*fileCache, error) {
+	file, err := cacheFile(s.file, true)
+	if err != nil {
+		return nil, err
+	}
+	return &fileCache{file: file}, nil
+}
+
+func (s *fileStore) Load() (*oauth.Token, error) {
+	f, err := s.cache()
+	if err != nil {
+		return nil, err
+	}
+	c, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, fs.ErrNotExist
+	}
+	return &c.Token, nil
+}
+
+func (s *fileStore) Save(tok *oauth.Token) error {
+	f, err := s.cache()
+	if err != nil {
+		return err
+	}
+	return f.save(&cacheEntry{Token: *tok})
+}
+
+// storeCache returns a cache using s.
+// A FileStore is used directly, so that it behaves exactly like Token.
+func storeCache(s Store) cache {
+	if fstore, ok := s.(*fileStore); ok {
+		if f, err := fstore.cache(); err == nil {
+			return f
+		}
+	}
+	return &anyStoreCache{s}
+}
+
+// An anyStoreCache is a cache using an arbitrary Store.
+// Stores record only the token, so the scopes it was obtained for are unknown.
+type anyStoreCache struct {
+	s Store
+}
+
+func (c *anyStoreCache) lock(context.Context) (unlock func(), err error) {
+	return func() {}, nil
+}
+
+func (c *anyStoreCache) load() (*cacheEntry, error) {
+	tok, err := c.s.Load()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cacheEntry{Token: *tok, unverified: true}, nil
+}
+
+func (c *anyStoreCache) save(e *cacheEntry) error {
+	return c.s.Save(&e.Token)
+}
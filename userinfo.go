@@ -0,0 +1,52 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// userInfo fetches the JSON object at the user info endpoint u
+// on behalf of the user authorized by tok.
+func userInfo(ctx context.Context, u string, tok *oauth.Token) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching user info: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := oauth.NewClient(ctx, oauth.StaticTokenSource(tok)).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching user info: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("fetching user info: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching user info: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var info map[string]any
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("fetching user info: %v", err)
+	}
+	return info, nil
+}
+
+// result returns the Result for the token in c.
+func (c *cacheEntry) result(cached bool) *Result {
+	email, _ := c.UserInfo["email"].(string)
+	if email == "" {
+		email = idTokenEmail(&c.Token)
+	}
+	return &Result{Token: &c.Token, Cached: cached, UserInfo: c.UserInfo, Email: email}
+}
@@ -0,0 +1,80 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	oauth "golang.org/x/oauth2"
+)
+
+// Validate checks that the token cached in file, as written by Token,
+// still works, without asking the user to authorize access. It makes an
+// authenticated GET request to testURL, such as the provider's userinfo
+// endpoint, refreshing the token first if needed and writing the refreshed
+// token back to file. The file name is interpreted as in Token.
+// The errors ErrNoCache, ErrMismatch, ErrExpired, and ErrUnauthorized,
+// which callers can test for using errors.Is, describe why the token
+// is unusable. Other errors, such as a failure to reach the provider,
+// say nothing about the token.
+func Validate(ctx context.Context, file string, cfg *oauth.Config, testURL string) error {
+	opts := newOptions([]Option{WithContext(ctx)})
+	file, err := cacheFile(file, opts.xdg)
+	if err != nil {
+		return err
+	}
+	cache := opts.fileCache(file)
+	unlock, err := cache.lock(ctx)
+	if err != nil {
+		return err
+	}
+	c, err := cache.load()
+	unlock()
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return fmt.Errorf("oauthprompt.Validate: %s: %w", file, ErrNoCache)
+	}
+	// Token would ask the user again for a token that does not match.
+	if !c.matches(cfg) || !c.covers(cfg.Scopes) {
+		return fmt.Errorf("oauthprompt.Validate: %w", ErrMismatch)
+	}
+	if c.expired() {
+		return fmt.Errorf("oauthprompt.Validate: %w", ErrExpired)
+	}
+
+	ts := newCachingTokenSource(opts.ctx, cache, cfg, c, opts)
+	if _, err := ts.Token(); err != nil {
+		// Only a response from the provider, such as invalid_grant,
+		// shows that the refresh token is no good.
+		var re *oauth.RetrieveError
+		if errors.As(err, &re) && re.Response != nil {
+			return fmt.Errorf("oauthprompt.Validate: %w: refreshing: %v", ErrExpired, err)
+		}
+		return fmt.Errorf("oauthprompt.Validate: refreshing: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", testURL, nil)
+	if err != nil {
+		return fmt.Errorf("oauthprompt.Validate: %v", err)
+	}
+	resp, err := oauth.NewClient(opts.ctx, ts).Do(req)
+	if err != nil {
+		return fmt.Errorf("oauthprompt.Validate: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("oauthprompt.Validate: %s: %w", resp.Status, ErrUnauthorized)
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("oauthprompt.Validate: GET %s: %s", testURL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2013 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauthprompt
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// debugf logs a message for WithVerbose.
+func (o *options) debugf(format string, args ...any) {
+	if o.verbose {
+		o.logf(format, args...)
+	}
+}
+
+// secretParams are the parameters whose values must not be logged.
+var secretParams = []string{"access_token", "refresh_token", "id_token", "code", "code_verifier", "client_secret", "state"}
+
+var (
+	secretNames  = strings.Join(secretParams, "|")
+	secretJSONRE = regexp.MustCompile(`("(?:` + secretNames + `)"\s*:\s*)"[^"]*"`)
+	secretFormRE = regexp.MustCompile(`\b((?:` + secretNames + `)=)[^&\s]*`)
+)
+
+// redact returns s, a JSON or form-encoded response body,
+// with the values of secretParams removed.
+func redact(s string) string {
+	s = secretJSONRE.ReplaceAllString(s, `$1"REDACTED"`)
+	return secretFormRE.ReplaceAllString(s, `${1}REDACTED`)
+}
+
+// redactURL returns u with the values of secretParams
+// in its query removed.
+func redactURL(u string) string {
+	v, err := url.Parse(u)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	q := v.Query()
+	for _, p := range secretParams {
+		if q.Has(p) {
+			q.Set(p, "REDACTED")
+		}
+	}
+	v.RawQuery = q.Encode()
+	return v.String()
+}